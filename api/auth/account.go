@@ -0,0 +1,459 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	TokenVerify = "VERIFY"
+	TokenReset  = "RESET"
+
+	accountTokenSize = 32
+	passwordMinSize  = 8
+	// passwordMaxSize is limit of bcrypt, the rest of password is ignored.
+	passwordMaxSize = 72
+	emailMaxSize    = 50
+	nameMaxSize     = 100
+
+	verifyExpired = 24 * time.Hour
+	resetExpired  = time.Hour
+)
+
+var errAccountToken = errors.New("token is invalid or expired")
+
+type RequestSignUp struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type RequestAccountEmail struct {
+	Email string `json:"email"`
+}
+
+type RequestAccountToken struct {
+	Token    string `json:"token" form:"token"`
+	Password string `json:"password" form:"password"`
+}
+
+type RequestChangePassword struct {
+	Current  string `json:"current"`
+	Password string `json:"password"`
+}
+
+func validatePassword(password string) error {
+	if len(password) < passwordMinSize {
+		return fmt.Errorf("password must be at least %d characters", passwordMinSize)
+	}
+	if len(password) > passwordMaxSize {
+		return fmt.Errorf("password must be at most %d characters", passwordMaxSize)
+	}
+	return nil
+}
+
+// validateEmail is plain address without name, it is lower case because s_email is unique by case.
+func validateEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", fmt.Errorf("email '%s' is invalid", email)
+	}
+	if len(email) > emailMaxSize {
+		return "", fmt.Errorf("email must be at most %d characters", emailMaxSize)
+	}
+	return email, nil
+}
+
+func validateSignUp(req *RequestSignUp) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if len([]rune(req.Name)) > nameMaxSize {
+		return fmt.Errorf("name must be at most %d characters", nameMaxSize)
+	}
+	email, err := validateEmail(req.Email)
+	if err != nil {
+		return err
+	}
+	req.Email = email
+	return validatePassword(req.Password)
+}
+
+// issueAccountToken create single-use token of user, unused token of the same type is revoked.
+func issueAccountToken(stx *db.PGTx, userId int64, eType string, expired time.Duration) (string, error) {
+	token, hash, err := api.RandomToken(accountTokenSize)
+	if err != nil {
+		return "", err
+	}
+
+	err = stx.Execute(`
+		UPDATE user_account_token SET t_used = NOW() WHERE user_id = $1 AND e_type = $2 AND t_used IS NULL;
+	`, userId, eType)
+	if err != nil {
+		return "", err
+	}
+
+	err = stx.Execute(`
+		INSERT INTO user_account_token (user_id, e_type, s_token, t_expired) VALUES ($1, $2, $3, $4);
+	`, userId, eType, hash, time.Now().Add(expired))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// useAccountToken mark token as used and return its user, errAccountToken if it is used or expired.
+func useAccountToken(stx *db.PGTx, token string, eType string) (int64, error) {
+	row, err := stx.QueryOne(`
+		UPDATE user_account_token SET t_used = NOW()
+		WHERE s_token = $1 AND e_type = $2 AND t_used IS NULL AND t_expired > NOW()
+		RETURNING user_id;
+	`, api.HashToken(token), eType)
+	if err == db.ErrNoRows {
+		return 0, errAccountToken
+	} else if err != nil {
+		return 0, err
+	}
+	return row.ToInt64("user_id"), nil
+}
+
+// revokeSession delete sessions of user except keep, tokens of them are denied by HandlerAuthMiddleware.
+func revokeSession(stx *db.PGTx, store *db.Storage, userId int64, keep string) error {
+	rows, err := stx.Query(`
+		DELETE FROM user_session WHERE user_id = $1 AND n_session::text <> $2 RETURNING n_session;
+	`, userId, keep)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return err
+	}
+	for _, row := range record {
+		if err := store.Delete(row["n_session"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendVerifyMail(name string, email string, token string) error {
+	link, err := accountURL("/v1/auth/verify/" + token)
+	if err != nil {
+		return err
+	}
+	return sendMail(email, "Verify your email", fmt.Sprintf(
+		"Hello %s,\n\nConfirm your email with the link below, it expires in %d hours.\n\n%s\n\nIf you did not sign up, ignore this email.\n",
+		name, int(verifyExpired.Hours()), link,
+	))
+}
+
+func sendResetMail(name string, email string, token string) error {
+	link, err := accountURL("/v1/auth/password/reset/" + token)
+	if err != nil {
+		return err
+	}
+	return sendMail(email, "Reset your password", fmt.Sprintf(
+		"Hello %s,\n\nSet a new password with the link below, it expires in %d minutes.\n\n%s\n\nIf you did not ask to reset password, ignore this email.\n",
+		name, int(resetExpired.Minutes()), link,
+	))
+}
+
+// HandlerV1SignUp create VISITOR account without role, it can sign in after email is verified
+// and has no permission until OWNER grant a role with HandlerV1GrantRole.
+func HandlerV1SignUp(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		req := new(RequestSignUp)
+		if err := c.BodyParser(req); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+		if err := validateSignUp(req); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		usr, err := stx.QueryOne(`
+			INSERT INTO user_account (s_display_name, s_email, s_pwd, n_level)
+			VALUES ($1, $2, crypt($3, gen_salt('bf')), 'VISITOR')
+			ON CONFLICT (s_email) DO NOTHING
+			RETURNING id, n_level;
+		`, req.Name, req.Email, req.Password)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusConflict, fmt.Errorf("email '%s' is already registered", req.Email))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if _, _, err := createUserKey(stx, usr.ToInt64("id")); db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		token, err := issueAccountToken(stx, usr.ToInt64("id"), TokenVerify, verifyExpired)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		// account is not created when email can not be sent, so it can sign up again.
+		if err := sendVerifyMail(req.Name, req.Email, token); db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(&UserAccount{
+			Name:       req.Name,
+			Email:      req.Email,
+			Level:      usr["n_level"],
+			Permission: []UserPermission{},
+		})
+	}
+}
+
+func verifyAccount(pgx *db.PGClient, token string) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	userId, err := useAccountToken(stx, token, TokenVerify)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	err = stx.Execute(`UPDATE user_account SET t_verified = COALESCE(t_verified, NOW()) WHERE id = $1;`, userId)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	return stx.Commit()
+}
+
+// HandlerV1Verify verify email with token of body.
+func HandlerV1Verify(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		req := new(RequestAccountToken)
+		if err := c.BodyParser(req); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+
+		err := verifyAccount(pgx, req.Token)
+		if err == errAccountToken {
+			return c.Status(fiber.StatusBadRequest).JSON(api.HttpErrorf(fiber.StatusBadRequest, err))
+		} else if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(fiber.Map{})
+	}
+}
+
+// HandlerV1VerifyPage verify email with link of email.
+func HandlerV1VerifyPage(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		err := verifyAccount(pgx, c.Params("token"))
+		if err == errAccountToken {
+			return c.Status(fiber.StatusNotFound).Render("auth-account", fiber.Map{"Title": "Verify email", "Error": "Link is invalid or expired"})
+		} else if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.Render("auth-account", fiber.Map{"Title": "Verify email", "Message": "Your email is verified, you can sign in now."})
+	}
+}
+
+// HandlerV1ResendVerify send new verify email, response is the same whether account exists or not.
+func HandlerV1ResendVerify(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return handlerAccountMail(pgx, `t_verified IS NULL`, TokenVerify, verifyExpired, sendVerifyMail)
+}
+
+// HandlerV1ForgotPassword send reset password email, response is the same whether account exists or not.
+func HandlerV1ForgotPassword(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return handlerAccountMail(pgx, `TRUE`, TokenReset, resetExpired, sendResetMail)
+}
+
+func handlerAccountMail(pgx *db.PGClient, where string, eType string, expired time.Duration, send func(name string, email string, token string) error) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		req := new(RequestAccountEmail)
+		if err := c.BodyParser(req); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+		email, err := validateEmail(req.Email)
+		if err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		usr, err := stx.QueryOne(fmt.Sprintf(`
+			SELECT id, s_display_name FROM user_account WHERE s_email = $1 AND n_level <> 'BANED' AND %s;
+		`, where), email)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return c.JSON(fiber.Map{})
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		token, err := issueAccountToken(stx, usr.ToInt64("id"), eType, expired)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if err := send(usr["s_display_name"], email, token); db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(fiber.Map{})
+	}
+}
+
+// HandlerV1ResetPasswordPage show form of new password when token of link can be used.
+func HandlerV1ResetPasswordPage(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		_, err = stx.QueryOne(`
+			SELECT id FROM user_account_token WHERE s_token = $1 AND e_type = $2 AND t_used IS NULL AND t_expired > NOW();
+		`, api.HashToken(c.Params("token")), TokenReset)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return c.Status(fiber.StatusNotFound).Render("auth-account", fiber.Map{"Title": "Reset password", "Error": "Link is invalid or expired"})
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		return c.Render("auth-account", fiber.Map{
+			"Title":    "Reset password",
+			"Action":   "/v1/auth/password/reset/" + c.Params("token"),
+			"MinSize":  passwordMinSize,
+			"MaxSize":  passwordMaxSize,
+			"Password": true,
+		})
+	}
+}
+
+// HandlerV1ResetPassword set new password with token of body or form of HandlerV1ResetPasswordPage,
+// every session of account is signed out.
+func HandlerV1ResetPassword(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		form := strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationForm)
+		throw := func(code int, err error) error {
+			if form {
+				return c.Status(code).Render("auth-account", fiber.Map{"Title": "Reset password", "Error": err.Error()})
+			}
+			return c.Status(code).JSON(api.HttpErrorf(code, err))
+		}
+
+		req := new(RequestAccountToken)
+		if err := c.BodyParser(req); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+		if c.Params("token") != "" {
+			req.Token = c.Params("token")
+		}
+		if err := validatePassword(req.Password); err != nil {
+			return throw(fiber.StatusBadRequest, err)
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		userId, err := useAccountToken(stx, req.Token, TokenReset)
+		if err == errAccountToken {
+			stx.Rollback()
+			return throw(fiber.StatusBadRequest, err)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		// the link of email prove its owner, so account is verified too.
+		err = stx.Execute(`
+			UPDATE user_account SET s_pwd = crypt($2, gen_salt('bf')), t_verified = COALESCE(t_verified, NOW()) WHERE id = $1;
+		`, userId, req.Password)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := revokeSession(stx, store, userId, ""); db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if form {
+			return c.Render("auth-account", fiber.Map{"Title": "Reset password", "Message": "Your password is changed, you can sign in now."})
+		}
+		return c.JSON(fiber.Map{})
+	}
+}
+
+// HandlerV1ChangePassword change password of signed in user, other sessions are signed out.
+func HandlerV1ChangePassword(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		claims := c.Locals("claims").(TokenClaims)
+
+		req := new(RequestChangePassword)
+		if err := c.BodyParser(req); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+		if err := validatePassword(req.Password); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		usr, err := stx.QueryOne(`
+			UPDATE user_account SET s_pwd = crypt($3, gen_salt('bf'))
+			WHERE n_object = $1 AND s_pwd IS NOT NULL AND s_pwd = crypt($2, s_pwd)
+			RETURNING id;
+		`, claims.UUID, req.Current, req.Password)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(api.HttpErrorPrint(fiber.StatusBadRequest, "current password is incorrect"))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := revokeSession(stx, store, usr.ToInt64("id"), claims.ID); db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(fiber.Map{})
+	}
+}
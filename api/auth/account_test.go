@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/touno-io/core/db"
+)
+
+// testPGClient connect postgres of PG_* environment and migrate the schema, test is skipped without it.
+func testPGClient(t *testing.T) *db.PGClient {
+	t.Helper()
+	if os.Getenv(db.PGHOST) == "" {
+		t.Skip("postgres is not set, PG_HOST is empty")
+	}
+
+	ctx := context.Background()
+	pgx := &db.PGClient{}
+	pgx.Connect(&ctx, "auth-test")
+	t.Cleanup(func() { pgx.Close() })
+
+	goose.SetTableName("db_version")
+	if err := goose.Up(pgx.DB, "../../db/schema"); err != nil {
+		t.Fatal(err)
+	}
+	return pgx
+}
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		want    string
+		wantErr bool
+	}{
+		{"admin@touno.io", "admin@touno.io", false},
+		{" Admin@Touno.IO ", "admin@touno.io", false},
+		{"Admin <admin@touno.io>", "", true},
+		{"admin", "", true},
+		{"", "", true},
+		{strings.Repeat("a", emailMaxSize) + "@touno.io", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			got, err := validateEmail(tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateEmail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("validateEmail() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSignUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     RequestSignUp
+		wantErr bool
+	}{
+		{"valid", RequestSignUp{Name: " Kananek ", Email: "Admin@touno.io", Password: "12345678"}, false},
+		{"no name", RequestSignUp{Name: " ", Email: "admin@touno.io", Password: "12345678"}, true},
+		{"long name", RequestSignUp{Name: strings.Repeat("ก", nameMaxSize+1), Email: "admin@touno.io", Password: "12345678"}, true},
+		{"invalid email", RequestSignUp{Name: "Kananek", Email: "admin", Password: "12345678"}, true},
+		{"short password", RequestSignUp{Name: "Kananek", Email: "admin@touno.io", Password: "1234567"}, true},
+		{"long password", RequestSignUp{Name: "Kananek", Email: "admin@touno.io", Password: strings.Repeat("1", passwordMaxSize+1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSignUp(&tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateSignUp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (tt.req.Name != "Kananek" || tt.req.Email != "admin@touno.io") {
+				t.Errorf("validateSignUp() = %+v, name and email are not normalized", tt.req)
+			}
+		})
+	}
+}
+
+func TestAccountURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{"link", "https://touno.io", "https://touno.io/v1/auth/verify/abc", false},
+		{"trailing slash", "https://touno.io/", "https://touno.io/v1/auth/verify/abc", false},
+		{"no AUTH_URL", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(AUTH_URL, tt.env)
+			got, err := accountURL("/v1/auth/verify/abc")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("accountURL() = %s %v, want %s", got, err, tt.want)
+			}
+			if !tt.wantErr {
+				return
+			}
+			if err := sendVerifyMail("admin", "admin@touno.io", "abc"); err != errAuthURL {
+				t.Errorf("sendVerifyMail() error = %v, want %v", err, errAuthURL)
+			}
+		})
+	}
+}
+
+// TestUseAccountToken need postgres, every row is created in a transaction which is rolled back.
+func TestUseAccountToken(t *testing.T) {
+	pgx := testPGClient(t)
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stx.Rollback()
+
+	newUser := func() int64 {
+		usr, err := stx.QueryOne(`
+			INSERT INTO user_account (s_display_name, s_email, n_level) VALUES ('token', $1, 'VISITOR') RETURNING id;
+		`, fmt.Sprintf("token-%d@touno.io", time.Now().UnixNano()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return usr.ToInt64("id")
+	}
+	issue := func(userId int64, eType string, expired time.Duration) string {
+		token, err := issueAccountToken(stx, userId, eType, expired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	userId, other := newUser(), newUser()
+	verify := issue(userId, TokenVerify, verifyExpired)
+	revoked := issue(userId, TokenReset, resetExpired)
+	reset := issue(userId, TokenReset, resetExpired)
+	expired := issue(other, TokenReset, -time.Minute)
+
+	tests := []struct {
+		name    string
+		token   string
+		eType   string
+		wantErr bool
+	}{
+		{"other type", verify, TokenReset, true},
+		{"verify", verify, TokenVerify, false},
+		{"used once", verify, TokenVerify, true},
+		{"expired", expired, TokenReset, true},
+		{"revoked by the next token", revoked, TokenReset, true},
+		{"reset", reset, TokenReset, false},
+		{"unknown", "unknown", TokenReset, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := useAccountToken(stx, tt.token, tt.eType)
+			if tt.wantErr {
+				if err != errAccountToken {
+					t.Errorf("useAccountToken() = %d %v, want %v", got, err, errAccountToken)
+				}
+				return
+			}
+			if err != nil || got != userId {
+				t.Errorf("useAccountToken() = %d %v, want user %d", got, err, userId)
+			}
+		})
+	}
+}
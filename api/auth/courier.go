@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const COURIER = "COURIER"
+
+// Courier is the app which send notice with a token of user_token.
+type Courier struct {
+	UserID int64  `json:"user_id"`
+	RoleID int64  `json:"role_id"`
+	Name   string `json:"name"`
+	Token  string `json:"-"`
+}
+
+// HandlerCourierMiddleware authorize app with 'Authorization: Bearer <user_token.n_session>' of role COURIER
+// and set Courier to locals "courier".
+func HandlerCourierMiddleware(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		auth := c.Get(fiber.HeaderAuthorization)
+		if len(auth) <= 7 || strings.ToLower(auth[:6]) != "bearer" {
+			return c.Status(401).JSON(api.HTTP{Error: "Unauthorized"})
+		}
+		token := strings.TrimSpace(auth[7:])
+		if len(token) != 32 {
+			return c.Status(401).JSON(api.HTTP{Error: "Unauthorized"})
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		app, err := stx.QueryOne(`
+			SELECT ut.user_id, ut.user_role_id, ua.s_display_name
+			FROM user_token ut
+			INNER JOIN user_account ua ON ua.id = ut.user_id
+			WHERE ut.n_session = $1 AND ut.e_role = $2 AND ua.n_level <> 'BANED';
+		`, token, COURIER)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return c.Status(401).JSON(api.HTTP{Error: "Unauthorized"})
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		c.Locals("courier", Courier{
+			UserID: app.ToInt64("user_id"),
+			RoleID: app.ToInt64("user_role_id"),
+			Name:   app["s_display_name"],
+			Token:  token,
+		})
+		return c.Next()
+	}
+}
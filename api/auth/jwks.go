@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const AUTH_AUDIENCE = "AUTH_AUDIENCE"
+
+type JSONWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type OpenIDConfiguration struct {
+	Issuer           string   `json:"issuer"`
+	JwksURI          string   `json:"jwks_uri"`
+	TokenEndpoint    string   `json:"token_endpoint"`
+	UserinfoEndpoint string   `json:"userinfo_endpoint"`
+	ResponseTypes    []string `json:"response_types_supported"`
+	SubjectTypes     []string `json:"subject_types_supported"`
+	SigningAlgs      []string `json:"id_token_signing_alg_values_supported"`
+	TokenAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+	Claims           []string `json:"claims_supported"`
+}
+
+// issuerURL is AUTH_URL, it is never taken from Host header of request so token can not be issued for other host.
+func issuerURL() (string, error) {
+	issuer := strings.TrimRight(os.Getenv(AUTH_URL), "/")
+	if issuer == "" {
+		return "", errAuthURL
+	}
+	return issuer, nil
+}
+
+// audience of token is AUTH_AUDIENCE or issuer when it is empty.
+func audience() (string, error) {
+	if os.Getenv(AUTH_AUDIENCE) != "" {
+		return os.Getenv(AUTH_AUDIENCE), nil
+	}
+	return issuerURL()
+}
+
+func publicJWK(kid string, der []byte) (JSONWebKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return JSONWebKey{}, err
+	}
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return JSONWebKey{}, errors.New("public key is not RSA")
+	}
+
+	encoding := base64.RawURLEncoding
+	return JSONWebKey{
+		Kid: kid,
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		N:   encoding.EncodeToString(publicKey.N.Bytes()),
+		E:   encoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}, nil
+}
+
+// HandlerJWKS publish public keys which can verify token, key of rotation is listed until its grace period is over.
+func HandlerJWKS(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		rows, err := stx.Query(`
+			SELECT uk.s_kid, uk.a_public_key
+			FROM user_account_key uk
+			INNER JOIN user_account ua ON ua.id = uk.user_id
+			WHERE ua.n_level <> 'BANED' AND (uk.t_expired IS NULL OR uk.t_expired > NOW())
+			ORDER BY uk.id;
+		`)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		record, err := stx.FetchAll(rows)
+		rows.Close()
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		jwks := JSONWebKeySet{Keys: []JSONWebKey{}}
+		for _, row := range record {
+			key, err := publicJWK(row["s_kid"], row.ToByte("a_public_key"))
+			if err != nil {
+				db.Errorf("Auth::JWKS %s %s", row["s_kid"], err)
+				continue
+			}
+			jwks.Keys = append(jwks.Keys, key)
+		}
+
+		// new key of rotation must be fetched before its token is used, so cache is short.
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.JSON(jwks)
+	}
+}
+
+// HandlerOpenIDConfiguration is discovery document of issuer for library which verify token with jwks_uri.
+func HandlerOpenIDConfiguration(c *fiber.Ctx) error {
+	issuer, err := issuerURL()
+	if err != nil {
+		return api.ThrowInternalServerError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return c.JSON(OpenIDConfiguration{
+		Issuer:           issuer,
+		JwksURI:          issuer + "/.well-known/jwks.json",
+		TokenEndpoint:    issuer + "/v1/auth",
+		UserinfoEndpoint: issuer + "/v1/auth/account",
+		ResponseTypes:    []string{"token"},
+		SubjectTypes:     []string{"public"},
+		SigningAlgs:      []string{"RS256"},
+		TokenAuthMethods: []string{"client_secret_basic"},
+		Claims:           []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "nae", "usr", "scp"},
+	})
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/api/secret"
+	"github.com/touno-io/core/db"
+)
+
+type UserKey struct {
+	ID      string     `json:"kid"`
+	Created time.Time  `json:"created"`
+	Expired *time.Time `json:"expired,omitempty"`
+}
+
+// sealPrivateKey is base64 of PKCS1 sealed with SECRET_KEYS.
+func sealPrivateKey(privateKey *rsa.PrivateKey) (string, error) {
+	return secret.Seal([]byte(base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(privateKey))))
+}
+
+// openPrivateKey of s_private_key, value which is not sealed yet is opened as it is.
+func openPrivateKey(value string) (*rsa.PrivateKey, error) {
+	plain, err := secret.Open(value)
+	if err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(string(plain))
+	if err != nil {
+		return nil, err
+	}
+	privateKey, _, err := ParsePKCS1PrivateKey(der)
+	return privateKey, err
+}
+
+// createUserKey generate the active key of user, the current active key must be expired before.
+func createUserKey(stx *db.PGTx, userId int64) (string, *rsa.PrivateKey, error) {
+	privateKey, publicKey, err := generateRSAKey()
+	if err != nil {
+		return "", nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", nil, err
+	}
+	sealed, err := sealPrivateKey(privateKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, err := stx.QueryOne(`
+		INSERT INTO user_account_key (user_id, a_public_key, s_private_key) VALUES ($1, $2, $3) RETURNING s_kid;
+	`, userId, publicDER, sealed)
+	if err != nil {
+		return "", nil, err
+	}
+	return key["s_kid"], privateKey, nil
+}
+
+// activeUserKey to sign token of user, it is created when user has no key.
+func activeUserKey(stx *db.PGTx, userId int64) (string, *rsa.PrivateKey, error) {
+	key, err := stx.QueryOne(`
+		SELECT s_kid, s_private_key FROM user_account_key WHERE user_id = $1 AND t_expired IS NULL;
+	`, userId)
+	if err == db.ErrNoRows {
+		return createUserKey(stx, userId)
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	privateKey, err := openPrivateKey(key["s_private_key"])
+	if err != nil {
+		return "", nil, err
+	}
+	return key["s_kid"], privateKey, nil
+}
+
+// findPublicKey of kid which is owned by user uuid and is not over its grace period.
+func findPublicKey(pgx *db.PGClient, kid string, uuid string) ([]byte, error) {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := stx.QueryOne(`
+		SELECT uk.a_public_key
+		FROM user_account_key uk
+		INNER JOIN user_account ua ON ua.id = uk.user_id
+		WHERE uk.s_kid = $1 AND ua.n_object::text = $2 AND (uk.t_expired IS NULL OR uk.t_expired > NOW());
+	`, kid, uuid)
+	if db.IsRollback(err, stx) {
+		return nil, err
+	}
+	if err := stx.Commit(); err != nil {
+		return nil, err
+	}
+	return key.ToByte("a_public_key"), nil
+}
+
+func queryUserKey(stx *db.PGTx, userId int64) ([]UserKey, error) {
+	rows, err := stx.Query(`
+		SELECT s_kid, t_created, t_expired FROM user_account_key
+		WHERE user_id = $1 AND (t_expired IS NULL OR t_expired > NOW())
+		ORDER BY t_created DESC;
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []UserKey{}
+	for _, row := range record {
+		key := UserKey{ID: row["s_kid"], Created: row.ToTime("t_created")}
+		if row["t_expired"] != "" {
+			expired := row.ToTime("t_expired")
+			key.Expired = &expired
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// HandlerV1GetKey list keys of signed in user which can verify token.
+func HandlerV1GetKey(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		claims := c.Locals("claims").(TokenClaims)
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		userId, err := api.QueryUserID(stx, claims.UUID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		keys, err := queryUserKey(stx, userId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(keys)
+	}
+}
+
+// HandlerV1RotateKey create new active key of signed in user, the previous key verify token as long as
+// access token is valid, so every token which is signed by it is not denied.
+func HandlerV1RotateKey(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		claims := c.Locals("claims").(TokenClaims)
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		userId, err := api.QueryUserID(stx, claims.UUID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = stx.Execute(`
+			DELETE FROM user_account_key WHERE user_id = $1 AND t_expired <= NOW();
+		`, userId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		err = stx.Execute(`
+			UPDATE user_account_key SET t_expired = $2 WHERE user_id = $1 AND t_expired IS NULL;
+		`, userId, time.Now().Add(accessExpired()))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if _, _, err := createUserKey(stx, userId); db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		keys, err := queryUserKey(stx, userId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(keys)
+	}
+}
+
+// RotateKeys seal plain text private keys, re-wrap private keys of old key with the active key of SECRET_KEYS
+// and delete keys which are over their grace period.
+func RotateKeys(pgx *db.PGClient) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	err = stx.Execute(`DELETE FROM user_account_key WHERE t_expired <= NOW();`)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	rows, err := stx.Query(`SELECT id, s_private_key FROM user_account_key;`)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	record, err := stx.FetchAll(rows)
+	rows.Close()
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	rotated := 0
+	for _, row := range record {
+		sealed, ok, err := secret.Rewrap(row["s_private_key"])
+		if db.IsRollback(err, stx) {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		err = stx.Execute(`UPDATE user_account_key SET s_private_key = $2 WHERE id = $1;`, row["id"], sealed)
+		if db.IsRollback(err, stx) {
+			return err
+		}
+		rotated++
+	}
+
+	if err := stx.Commit(); err != nil {
+		return err
+	}
+	if rotated > 0 {
+		db.Infof("Auth::RotateKeys %d private keys are sealed with active key", rotated)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+const (
+	AUTH_URL      = "AUTH_URL"
+	SMTP_HOST     = "SMTP_HOST"
+	SMTP_PORT     = "SMTP_PORT"
+	SMTP_USER     = "SMTP_USER"
+	SMTP_PASS     = "SMTP_PASS"
+	SMTP_FROM     = "SMTP_FROM"
+	SMTP_INSECURE = "SMTP_INSECURE"
+)
+
+var (
+	errMailConfig = errors.New("smtp is not configured")
+	errAuthURL    = errors.New("AUTH_URL is not configured")
+)
+
+// sendMail send plain text email of account with SMTP of environment, port is 587 by default.
+func sendMail(to string, subject string, body string) error {
+	host := os.Getenv(SMTP_HOST)
+	from := os.Getenv(SMTP_FROM)
+	if host == "" || from == "" {
+		return errMailConfig
+	}
+
+	port := 587
+	if os.Getenv(SMTP_PORT) != "" {
+		n, err := strconv.Atoi(os.Getenv(SMTP_PORT))
+		if err != nil {
+			return fmt.Errorf("%s: %s", SMTP_PORT, err)
+		}
+		port = n
+	}
+
+	email := gomail.NewMessage()
+	email.SetHeader("From", from)
+	email.SetHeader("To", to)
+	email.SetHeader("Subject", subject)
+	email.SetBody("text/plain", body)
+
+	deliver := gomail.NewDialer(host, port, os.Getenv(SMTP_USER), os.Getenv(SMTP_PASS))
+	deliver.TLSConfig = &tls.Config{ServerName: host, InsecureSkipVerify: os.Getenv(SMTP_INSECURE) == "true"}
+
+	return deliver.DialAndSend(email)
+}
+
+// accountURL is link of path in email with AUTH_URL as issuer, email is not sent when it is empty
+// so a link can not be pointed to other host by Host header of request.
+func accountURL(path string) (string, error) {
+	issuer, err := issuerURL()
+	if err != nil {
+		return "", err
+	}
+	return issuer + path, nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+// PermissionAll is scope of OWNER level, it match every permission.
+const PermissionAll = "*"
+
+// ResolvePermission name of permissions from roles of user, OWNER has every permission.
+func ResolvePermission(stx *db.PGTx, userId int64, level string) ([]string, error) {
+	if level == "OWNER" {
+		return []string{PermissionAll}, nil
+	}
+
+	rows, err := stx.Query(`
+		SELECT DISTINCT up.s_name
+		FROM user_account_role ar
+		INNER JOIN user_role_permission rp ON rp.user_role_id = ar.user_role_id
+		INNER JOIN user_permission up ON up.id = rp.user_permission_id
+		WHERE ar.user_id = $1
+		ORDER BY up.s_name;
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []string{}
+	for _, row := range record {
+		scopes = append(scopes, row["s_name"])
+	}
+	return scopes, nil
+}
+
+// HasPermission scope is '*', the same name or '<resource>:*' of name.
+func HasPermission(scopes []string, name string) bool {
+	resource, _, _ := strings.Cut(name, ":")
+	for _, scope := range scopes {
+		if scope == PermissionAll || scope == name || scope == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission allow request which token has every permission of names, it must be after HandlerAuthMiddleware.
+func RequirePermission(names ...string) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("claims").(TokenClaims)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(api.HTTP{Error: "Unauthorized"})
+		}
+		for _, name := range names {
+			if !HasPermission(claims.Scopes, name) {
+				return c.Status(fiber.StatusForbidden).JSON(api.HttpErrorPrint(fiber.StatusForbidden, "permission '%s' is required", name))
+			}
+		}
+		return c.Next()
+	}
+}
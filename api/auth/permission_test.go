@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		perm   string
+		want   bool
+	}{
+		{"all", []string{PermissionAll}, "monitor:write", true},
+		{"same name", []string{"monitor:read", "monitor:write"}, "monitor:write", true},
+		{"resource", []string{"monitor:*"}, "monitor:write", true},
+		{"other action", []string{"monitor:read"}, "monitor:write", false},
+		{"other resource", []string{"notice:*"}, "monitor:write", false},
+		{"prefix is not resource", []string{"mon:*"}, "monitor:write", false},
+		{"name is not prefix", []string{"monitor"}, "monitor:write", false},
+		{"no scope", nil, "monitor:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.scopes, tt.perm); got != tt.want {
+				t.Errorf("HasPermission(%v, %s) = %v, want %v", tt.scopes, tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePermissionOwner(t *testing.T) {
+	scopes, err := ResolvePermission(nil, 1, "OWNER")
+	if err != nil || !reflect.DeepEqual(scopes, []string{PermissionAll}) {
+		t.Errorf("ResolvePermission() = %v %v, want %s", scopes, err, PermissionAll)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims any
+		names  []string
+		status int
+	}{
+		{"no token", nil, []string{"monitor:read"}, fiber.StatusUnauthorized},
+		{"permission", TokenClaims{Scopes: []string{"monitor:read"}}, []string{"monitor:read"}, fiber.StatusOK},
+		{"every permission", TokenClaims{Scopes: []string{"monitor:*", "notice:read"}}, []string{"monitor:write", "notice:read"}, fiber.StatusOK},
+		{"one is missing", TokenClaims{Scopes: []string{"monitor:*"}}, []string{"monitor:write", "notice:read"}, fiber.StatusForbidden},
+		{"no scope", TokenClaims{}, []string{"monitor:read"}, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				if tt.claims != nil {
+					c.Locals("claims", tt.claims)
+				}
+				return c.Next()
+			}, RequirePermission(tt.names...), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			res, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+}
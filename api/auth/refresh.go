@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"time"
+
+	jose "github.com/dvsekhvalnov/jose2go"
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	AUTH_ACCESS_EXPIRED  = "AUTH_ACCESS_EXPIRED"
+	AUTH_REFRESH_EXPIRED = "AUTH_REFRESH_EXPIRED"
+)
+
+type RequestRefresh struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// accessExpired is lifetime of access token, 15 minutes by default.
+func accessExpired() time.Duration {
+	return envDuration(AUTH_ACCESS_EXPIRED, 15*time.Minute)
+}
+
+// refreshExpired is lifetime of refresh token and its session, 30 days by default. session slide at every refresh.
+func refreshExpired() time.Duration {
+	return envDuration(AUTH_REFRESH_EXPIRED, 30*24*time.Hour)
+}
+
+func envDuration(name string, value time.Duration) time.Duration {
+	if os.Getenv(name) == "" {
+		return value
+	}
+
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || d <= 0 {
+		db.Errorf("ENV::%s must be duration such as '15m' or '720h'", name)
+		return value
+	}
+	return d
+}
+
+// issueToken sign access token of session and rotate its refresh token, session is extended by refreshExpired.
+func issueToken(stx *db.PGTx, store *db.Storage, usr db.PGRow, sessionId string) (*AuthToken, error) {
+	issuer, err := issuerURL()
+	if err != nil {
+		return nil, err
+	}
+	aud, err := audience()
+	if err != nil {
+		return nil, err
+	}
+
+	kid, privateKey, err := activeUserKey(stx, usr.ToInt64("id"))
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := ResolvePermission(stx, usr.ToInt64("id"), usr["n_level"])
+	if err != nil {
+		return nil, err
+	}
+	permission, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(map[string][]string{"scopes": scopes})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expired := now.Add(refreshExpired())
+	err = stx.Execute(`UPDATE user_session SET o_permission = $2, t_expired = $3 WHERE n_session = $1;`, sessionId, permission, expired)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Set(sessionId, publicKey, refreshExpired()); err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := api.RandomToken(accountTokenSize)
+	if err != nil {
+		return nil, err
+	}
+	err = stx.Execute(`
+		INSERT INTO user_session_refresh (n_session, s_token, t_expired) VALUES ($1, $2, $3);
+	`, sessionId, hash, expired)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(TokenClaims{
+		Name:      usr["s_display_name"],
+		UUID:      usr["n_object"],
+		Subject:   usr["n_object"],
+		Audience:  aud,
+		ID:        sessionId,
+		Issuer:    issuer,
+		NotBefore: now.Unix(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(accessExpired()).Unix(),
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tokenString, err := jose.SignBytes(payload, jose.RS256, privateKey, jose.Header("kid", kid))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthToken{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessExpired().Seconds()),
+	}, nil
+}
+
+// revokeFamily delete session with every refresh token of it.
+func revokeFamily(stx *db.PGTx, store *db.Storage, sessionId string) error {
+	if err := stx.Execute(`DELETE FROM user_session WHERE n_session = $1;`, sessionId); err != nil {
+		return err
+	}
+	return store.Delete(sessionId)
+}
+
+// HandlerV1Refresh exchange refresh token for new access and refresh token, refresh token can be used once.
+// refresh token which is used again revoke its session, so a stolen token stop working for both of its holders.
+func HandlerV1Refresh(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		req := new(RequestRefresh)
+		if err := c.BodyParser(req); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+		if req.RefreshToken == "" {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, errors.New("refresh_token is required"))
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		usr, err := stx.QueryOne(`
+			SELECT sr.id AS refresh_id, sr.n_session, sr.t_used, sr.t_expired > NOW() AS b_active,
+				ua.id, ua.n_level, ua.n_object, ua.s_display_name
+			FROM user_session_refresh sr
+			INNER JOIN user_session us ON us.n_session = sr.n_session
+			INNER JOIN user_account ua ON ua.id = us.user_id
+			WHERE sr.s_token = $1
+			FOR UPDATE OF sr;
+		`, api.HashToken(req.RefreshToken))
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return c.Status(fiber.StatusUnauthorized).JSON(api.HTTP{Error: "Unauthorized"})
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if usr["t_used"] != "" || usr["n_level"] == "BANED" {
+			if err := revokeFamily(stx, store, usr["n_session"]); db.IsRollback(err, stx) {
+				return api.ThrowInternalServerError(c, err)
+			}
+			if err := stx.Commit(); err != nil {
+				return api.ThrowInternalServerError(c, err)
+			}
+			if usr["t_used"] != "" {
+				db.Warnf("Auth::Refresh session %s is revoked, refresh token is reused", usr["n_session"])
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(api.HTTP{Error: "Unauthorized"})
+		}
+		if !usr.ToBoolean("b_active") {
+			stx.Rollback()
+			return c.Status(fiber.StatusUnauthorized).JSON(api.HTTP{Error: "Unauthorized"})
+		}
+
+		err = stx.Execute(`UPDATE user_session_refresh SET t_used = NOW() WHERE id = $1;`, usr["refresh_id"])
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		token, err := issueToken(stx, store, usr, usr["n_session"])
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(token)
+	}
+}
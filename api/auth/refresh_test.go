@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/api/secret"
+	"github.com/touno-io/core/db"
+)
+
+func TestEnvDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"not set", "", 15 * time.Minute},
+		{"minutes", "5m", 5 * time.Minute},
+		{"hours", "720h", 720 * time.Hour},
+		{"not a duration", "30", 15 * time.Minute},
+		{"zero", "0s", 15 * time.Minute},
+		{"negative", "-1h", 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(AUTH_ACCESS_EXPIRED, tt.value)
+			if got := accessExpired(); got != tt.want {
+				t.Errorf("accessExpired() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAudience expect error of issuerURL or audience when its want is empty.
+func TestAudience(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		aud      string
+		issuer   string
+		audience string
+	}{
+		{"issuer is audience", "https://touno.io/", "", "https://touno.io", "https://touno.io"},
+		{"audience", "https://touno.io", "core", "https://touno.io", "core"},
+		{"no AUTH_URL", "", "", "", ""},
+		{"no AUTH_URL with audience", "", "core", "", "core"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(AUTH_URL, tt.url)
+			t.Setenv(AUTH_AUDIENCE, tt.aud)
+			if got, err := issuerURL(); got != tt.issuer || (err != nil) != (tt.issuer == "") {
+				t.Errorf("issuerURL() = %s %v, want %s", got, err, tt.issuer)
+			}
+			if got, err := audience(); got != tt.audience || (err != nil) != (tt.audience == "") {
+				t.Errorf("audience() = %s %v, want %s", got, err, tt.audience)
+			}
+		})
+	}
+}
+
+func postRefresh(t *testing.T, app *fiber.App, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, "/refresh", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(data)
+}
+
+func TestHandlerV1RefreshBadRequest(t *testing.T) {
+	app := fiber.New()
+	app.Post("/refresh", HandlerV1Refresh(nil, nil))
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty body", ""},
+		{"invalid json", "{"},
+		{"no refresh token", "{}"},
+		{"empty refresh token", `{"refresh_token":""}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, body := postRefresh(t, app, tt.body); status != fiber.StatusBadRequest {
+				t.Errorf("status = %d %s, want %d", status, body, fiber.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// TestHandlerV1RefreshReuse need postgres, a refresh token which is used again revoke the session.
+func TestHandlerV1RefreshReuse(t *testing.T) {
+	pgx := testPGClient(t)
+	if os.Getenv(secret.SECRET_KEYS) == "" {
+		t.Setenv(secret.SECRET_KEYS, "test:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	}
+	t.Setenv(AUTH_URL, "https://touno.io")
+	for _, query := range []string{
+		`CREATE SCHEMA IF NOT EXISTS "cache";`,
+		`CREATE TABLE IF NOT EXISTS "cache"."session_test" (
+			s_key VARCHAR(64) PRIMARY KEY NOT NULL DEFAULT '', a_value BYTEA NOT NULL, t_expire BIGINT NOT NULL DEFAULT '0'
+		);`,
+	} {
+		if _, err := pgx.DB.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := db.CacheNew(pgx, "session_test")
+
+	var userId int64
+	var sessionId string
+	email := fmt.Sprintf("refresh-%d@touno.io", time.Now().UnixNano())
+	err := pgx.DB.QueryRow(`
+		INSERT INTO user_account (s_display_name, s_email, n_level) VALUES ('refresh', $1, 'VISITOR') RETURNING id;
+	`, email).Scan(&userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		pgx.DB.Exec(`DELETE FROM user_session WHERE user_id = $1;`, userId)
+		pgx.DB.Exec(`DELETE FROM user_account_key WHERE user_id = $1;`, userId)
+		pgx.DB.Exec(`DELETE FROM user_account WHERE id = $1;`, userId)
+	}()
+
+	err = pgx.DB.QueryRow(`
+		INSERT INTO user_session (user_id, s_ipaddr, t_expired) VALUES ($1, '127.0.0.1', NOW() + INTERVAL '1 DAY') RETURNING n_session;
+	`, userId).Scan(&sessionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, hash, err := api.RandomToken(accountTokenSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pgx.DB.Exec(`
+		INSERT INTO user_session_refresh (n_session, s_token, t_expired) VALUES ($1, $2, NOW() + INTERVAL '1 DAY');
+	`, sessionId, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Post("/refresh", HandlerV1Refresh(pgx, store))
+
+	status, body := postRefresh(t, app, `{"refresh_token":"`+first+`"}`)
+	if status != fiber.StatusOK {
+		t.Fatalf("refresh status = %d %s, want %d", status, body, fiber.StatusOK)
+	}
+	token := new(AuthToken)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.UnmarshalFromString(body, token); err != nil {
+		t.Fatal(err)
+	}
+	if token.Token == "" || token.RefreshToken == "" || token.RefreshToken == first {
+		t.Fatalf("refresh token %s is not rotated", body)
+	}
+
+	if status, body := postRefresh(t, app, `{"refresh_token":"`+first+`"}`); status != fiber.StatusUnauthorized {
+		t.Fatalf("reused refresh status = %d %s, want %d", status, body, fiber.StatusUnauthorized)
+	}
+	var sessions int
+	if err := pgx.DB.QueryRow(`SELECT COUNT(*) FROM user_session WHERE n_session = $1;`, sessionId).Scan(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	if sessions != 0 {
+		t.Errorf("session %s is not revoked after refresh token is reused", sessionId)
+	}
+	if key, _ := store.Get(sessionId); key != nil {
+		t.Errorf("public key of session %s is kept in store", sessionId)
+	}
+
+	if status, body := postRefresh(t, app, `{"refresh_token":"`+token.RefreshToken+`"}`); status != fiber.StatusUnauthorized {
+		t.Errorf("rotated refresh status = %d %s after reuse, want %d", status, body, fiber.StatusUnauthorized)
+	}
+	if status, body := postRefresh(t, app, `{"refresh_token":"unknown"}`); status != fiber.StatusUnauthorized {
+		t.Errorf("unknown refresh status = %d %s, want %d", status, body, fiber.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+type UserRole struct {
+	Name       string   `json:"name"`
+	Permission []string `json:"permission"`
+}
+
+type RequestGrantRole struct {
+	Email string   `json:"mail"`
+	Roles []string `json:"roles"`
+}
+
+// ownerHandler begin transaction when signed in user is OWNER, level is read from account instead of token
+// so an account which is not OWNER anymore can not use its token which is not expired yet.
+func ownerHandler(pgx *db.PGClient, fn func(c *fiber.Ctx, stx *db.PGTx) error) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		claims := c.Locals("claims").(TokenClaims)
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		_, err = stx.QueryOne(`SELECT id FROM user_account WHERE n_object = $1 AND n_level = 'OWNER';`, claims.UUID)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return c.Status(fiber.StatusForbidden).JSON(api.HttpErrorPrint(fiber.StatusForbidden, "level 'OWNER' is required"))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return fn(c, stx)
+	}
+}
+
+func queryRoles(stx *db.PGTx) ([]UserRole, error) {
+	rows, err := stx.Query(`
+		SELECT ur.s_name, COALESCE(string_agg(up.s_name, ',' ORDER BY up.s_name), '') s_permission
+		FROM user_role ur
+		LEFT JOIN user_role_permission rp ON rp.user_role_id = ur.id
+		LEFT JOIN user_permission up ON up.id = rp.user_permission_id
+		GROUP BY ur.id, ur.s_name
+		ORDER BY ur.n_role, ur.s_name;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []UserRole{}
+	for _, row := range record {
+		permission := []string{}
+		if row["s_permission"] != "" {
+			permission = strings.Split(row["s_permission"], ",")
+		}
+		roles = append(roles, UserRole{Name: row["s_name"], Permission: permission})
+	}
+	return roles, nil
+}
+
+// HandlerV1GetRole list roles with their permissions, only OWNER can see them.
+func HandlerV1GetRole(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return ownerHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx) error {
+		roles, err := queryRoles(stx)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(roles)
+	})
+}
+
+// HandlerV1GrantRole replace roles of account by email, only OWNER can grant roles.
+// token of the account get new permission when it is refreshed.
+func HandlerV1GrantRole(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return ownerHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx) error {
+		req := new(RequestGrantRole)
+		if err := c.BodyParser(req); err != nil {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+		if req.Roles == nil {
+			req.Roles = []string{}
+		}
+		email, err := validateEmail(req.Email)
+		if err != nil {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+		req.Email = email
+
+		usr, err := stx.QueryOne(`SELECT id FROM user_account WHERE s_email = $1;`, req.Email)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("account '%s' not found", req.Email))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		roles, err := queryRoles(stx)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		for _, name := range req.Roles {
+			found := false
+			for _, role := range roles {
+				found = found || role.Name == name
+			}
+			if !found {
+				stx.Rollback()
+				return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("role '%s' not found", name))
+			}
+		}
+
+		err = stx.Execute(`DELETE FROM user_account_role WHERE user_id = $1;`, usr.ToInt64("id"))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		for _, name := range req.Roles {
+			err = stx.Execute(`
+				INSERT INTO user_account_role (user_id, user_role_id)
+				SELECT $1, id FROM user_role WHERE s_name = $2
+				ON CONFLICT DO NOTHING;
+			`, usr.ToInt64("id"), name)
+			if db.IsRollback(err, stx) {
+				return api.ThrowInternalServerError(c, err)
+			}
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(req)
+	})
+}
@@ -18,17 +18,25 @@ import (
 )
 
 type AuthToken struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// ExpiresIn is seconds until token is expired.
+	ExpiresIn int64 `json:"expires_in,omitempty"`
 }
 
+// TokenClaims are registered claims of RFC 7519, times are seconds since epoch.
 type TokenClaims struct {
 	Name      string `json:"nae"`
 	UUID      string `json:"usr"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
 	ID        string `json:"jti"`
 	Issuer    string `json:"iss"`
 	NotBefore int64  `json:"nbf"`
 	IssuedAt  int64  `json:"iat"`
 	ExpiresAt int64  `json:"exp"`
+	// Scopes are permissions of user which are resolved at sign in.
+	Scopes []string `json:"scp,omitempty"`
 }
 
 func HandlerAuthMiddleware(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ctx) error {
@@ -47,9 +55,17 @@ func HandlerAuthMiddleware(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ct
 
 			c.Locals("claims", claims)
 
-			if time.Now().Sub(time.Unix(claims.NotBefore, 0)) < 0 && time.Now().Sub(time.Unix(claims.ExpiresAt, 0)) > 0 {
+			now := time.Now()
+			if now.Before(time.Unix(claims.NotBefore, 0)) || now.After(time.Unix(claims.ExpiresAt, 0)) {
 				return fmt.Errorf("Session Expired")
 			}
+			aud, err := audience()
+			if err != nil {
+				return err
+			}
+			if claims.Audience != aud {
+				return fmt.Errorf("Audience Deny")
+			}
 
 			publicBytes, err := store.Get(claims.ID)
 			if publicBytes == nil && err == nil {
@@ -60,6 +76,14 @@ func HandlerAuthMiddleware(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ct
 				return err
 			}
 
+			// token which has kid is verified by the key of it, so token of rotated key is valid until its grace period is over.
+			if kid, ok := headers["kid"].(string); ok && kid != "" {
+				publicBytes, err = findPublicKey(pgx, kid, claims.UUID)
+				if err != nil {
+					return err
+				}
+			}
+
 			publicKey, err := x509.ParsePKIXPublicKey(publicBytes)
 			if err != nil {
 				return err
@@ -98,8 +122,8 @@ func HandlerV1BasicSignIn(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ctx
 
 		ipAddr := api.GetConnectingIP(c)
 
-		usr, err := stx.QueryOne(`SELECT id, n_level, n_object, s_display_name, a_private_key, a_public_key FROM user_account 
-			WHERE s_email = $1 AND (s_pwd is NOT NULL AND s_pwd = crypt($2, s_pwd));`, c.Locals("username"), c.Locals("password"))
+		usr, err := stx.QueryOne(`SELECT id, n_level, n_object, s_display_name, t_verified FROM user_account 
+			WHERE s_email = LOWER($1) AND (s_pwd is NOT NULL AND s_pwd = crypt($2, s_pwd));`, c.Locals("username"), c.Locals("password"))
 
 		if db.IsRollbackThrow(err, stx) {
 			return api.ErrorHandlerThrow(c, fiber.StatusUnauthorized, err)
@@ -113,11 +137,16 @@ func HandlerV1BasicSignIn(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ctx
 				db.Trace.Fatalf("stx: %s", err)
 			}
 			return api.ErrorHandlerThrow(c, fiber.StatusUnauthorized, errors.New("Baned"))
+		} else if usr["t_verified"] == "" {
+			if err := stx.Rollback(); err != nil {
+				db.Trace.Fatalf("stx: %s", err)
+			}
+			return api.ErrorHandlerThrow(c, fiber.StatusUnauthorized, errors.New("Unverified"))
 		}
 		var sessionId string
 		check, err := stx.QueryOne(`
 			SELECT n_session FROM user_session
-			WHERE user_id = $1 AND s_ipaddr = $2 AND t_created >= NOW() - INTERVAL '1 DAY'
+			WHERE user_id = $1 AND s_ipaddr = $2 AND t_expired > NOW()
 		`, usr.ToInt64("id"), ipAddr)
 
 		if err != db.ErrNoRows && err != nil {
@@ -125,9 +154,17 @@ func HandlerV1BasicSignIn(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ctx
 		} else if err != db.ErrNoRows {
 			sessionId = check["n_session"]
 		} else {
+			// refresh tokens of the expired session are dropped before the session is renewed.
+			err = stx.Execute(`
+				DELETE FROM user_session_refresh WHERE n_session IN (SELECT n_session FROM user_session WHERE user_id = $1 AND s_ipaddr = $2);
+			`, usr.ToInt64("id"), ipAddr)
+			if db.IsRollbackThrow(err, stx) {
+				return api.ThrowInternalServerError(c, err)
+			}
+
 			sess, err := stx.QueryOne(`
 			INSERT INTO user_session (user_id, s_ipaddr) VALUES ($1, $2)
-			ON CONFLICT ON CONSTRAINT uq_user_ip
+			ON CONFLICT ON CONSTRAINT uq_session_ip
 			DO UPDATE SET n_session = uuid_generate_v4(), t_created = NOW()
 			RETURNING n_session;
 		`, usr.ToInt64("id"), ipAddr)
@@ -136,30 +173,10 @@ func HandlerV1BasicSignIn(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ctx
 				return api.ThrowInternalServerError(c, err)
 			}
 			sessionId = sess["n_session"]
-			err = store.Set(sessionId, usr.ToByte("a_public_key"), time.Hour*24)
-			if db.IsRollbackThrow(err, stx) {
-				return api.ThrowInternalServerError(c, err)
-			}
-		}
-
-		privateKey, _, err := ParsePKCS1PrivateKey(usr.ToByte("a_private_key"))
-		if err != nil {
-			return api.ThrowInternalServerError(c, err)
 		}
 
-		payload, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(TokenClaims{
-			Name:      usr["s_display_name"],
-			UUID:      usr["n_object"],
-			ID:        sessionId,
-			Issuer:    c.Locals("username").(string),
-			NotBefore: getTimeStamp(time.Now()),
-			IssuedAt:  getTimeStamp(time.Now()),
-			ExpiresAt: getTimeStamp(time.Now().Add(24 * time.Hour)),
-		})
-
-		tokenString, err := jose.SignBytes(payload, jose.RS256, privateKey)
-
-		if err != nil {
+		token, err := issueToken(stx, store, usr, sessionId)
+		if db.IsRollbackThrow(err, stx) {
 			return api.ThrowInternalServerError(c, err)
 		}
 
@@ -167,7 +184,7 @@ func HandlerV1BasicSignIn(pgx *db.PGClient, store *db.Storage) func(c *fiber.Ctx
 			db.Trace.Fatalf("stx: %s", err)
 		}
 
-		return c.JSON(AuthToken{Token: tokenString})
+		return c.JSON(token)
 	}
 }
 
@@ -199,11 +216,16 @@ func HandlerV1UserInfo(pgx *db.PGClient) func(c *fiber.Ctx) error {
 			db.Trace.Fatalf("stx: %s", err)
 		}
 
+		permission := []UserPermission{}
+		for _, scope := range claims.Scopes {
+			permission = append(permission, UserPermission{Name: scope})
+		}
+
 		return c.JSON(&UserAccount{
 			Name:       account["s_display_name"],
 			Email:      account["s_email"],
 			Level:      account["n_level"],
-			Permission: []UserPermission{},
+			Permission: permission,
 		})
 	}
 }
@@ -244,23 +266,6 @@ func generateRSAKey() (*rsa.PrivateKey, *rsa.PublicKey, error) {
 	return privateKey, &privateKey.PublicKey, nil
 }
 
-func createNewRSAKey(stx *db.PGTx, userId string) error {
-	privateKey, publicKey, err := generateRSAKey()
-	pemPublic, err := x509.MarshalPKIXPublicKey(publicKey)
-	if err != nil {
-		return err
-	}
-
-	err = stx.Execute(`
-		UPDATE user_account SET a_private_key=$2, a_public_key=$3 WHERE id = $1;
-	`, userId, x509.MarshalPKCS1PrivateKey(privateKey), pemPublic)
-	if db.IsRollbackThrow(err, stx) {
-		return err
-	}
-
-	return nil
-}
-
 func ParsePKCS1PrivateKey(privateKey []byte) (*rsa.PrivateKey, *rsa.PublicKey, error) {
 	priv, err := x509.ParsePKCS1PrivateKey(privateKey)
 	if err != nil {
@@ -281,7 +286,3 @@ func PEMEncodeToMemory(privateKey *rsa.PrivateKey) ([]byte, []byte, error) {
 	pemPublic = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pemPublic})
 	return pemPrivate, pemPublic, nil
 }
-
-func getTimeStamp(t time.Time) int64 {
-	return t.UnixNano() / int64(time.Millisecond)
-}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/touno-io/core/db"
+)
+
+// QueryUserID id of account by n_object, uuid is UUID of token claims of signed in user.
+func QueryUserID(stx *db.PGTx, uuid string) (int64, error) {
+	row, err := stx.QueryOne(`SELECT id FROM user_account WHERE n_object = $1;`, uuid)
+	if err == db.ErrNoRows {
+		return 0, fmt.Errorf("user %s not found", uuid)
+	} else if err != nil {
+		return 0, err
+	}
+	return row.ToInt64("id"), nil
+}
+
+// RandomToken random token of link or refresh token in base64 url, only HashToken of it is stored.
+func RandomToken(size int) (string, string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken sha256 of token in hex, token is looked up by its hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestRandomToken(t *testing.T) {
+	tests := []struct {
+		size int
+		want int
+	}{
+		{32, 43},
+		{16, 22},
+	}
+
+	for _, tt := range tests {
+		token, hash, err := RandomToken(tt.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(token) != tt.want {
+			t.Errorf("RandomToken(%d) = %s, want %d characters", tt.size, token, tt.want)
+		}
+		sum := sha256.Sum256([]byte(token))
+		if hash != hex.EncodeToString(sum[:]) || hash != HashToken(token) {
+			t.Errorf("RandomToken(%d) hash %s is not sha256 of token", tt.size, hash)
+		}
+		if other, _, _ := RandomToken(tt.size); other == token {
+			t.Errorf("RandomToken(%d) is the same token", tt.size)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
@@ -114,6 +115,35 @@ func HanderMiddlewareSecurity(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// HandlerBodyLimit reject request body over limit and read body stream in full, so only route which is registered
+// before it read its body as stream with its own limit.
+func HandlerBodyLimit(limit int) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		length := c.Request().Header.ContentLength()
+		if length > limit {
+			// body is not read, connection can not be reused for next request.
+			c.Context().SetConnectionClose()
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(HttpErrorPrint(fiber.StatusRequestEntityTooLarge, "request body must be at most %d bytes", limit))
+		}
+
+		// body is read here as if it is not streamed, chunked body has no length so handler never read more than limit.
+		if stream := c.Context().RequestBodyStream(); stream != nil {
+			body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+			if err != nil || len(body) > limit {
+				c.Context().SetConnectionClose()
+			}
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(HttpErrorPrint(fiber.StatusBadRequest, "%s", err))
+			}
+			if len(body) > limit {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(HttpErrorPrint(fiber.StatusRequestEntityTooLarge, "request body must be at most %d bytes", limit))
+			}
+			c.Request().SetBody(body)
+		}
+		return c.Next()
+	}
+}
+
 func HandlerHealth(c *fiber.Ctx) error {
 	return c.SendString("☕")
 }
@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var dnsRecords = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT"}
+
+// ProbeDNS resolve record of host, optional with resolver 'ip:port' and expected answer.
+func ProbeDNS(proto *Protocol) *Heartbeat {
+	resolver := net.DefaultResolver
+	if proto.Param.Resolver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return (&net.Dialer{Timeout: proto.Timeout}).DialContext(ctx, network, proto.Param.Resolver)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), proto.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	answers, err := lookupRecord(ctx, resolver, strings.ToUpper(proto.Param.Record), proto.Host)
+	latency := elapsed(start)
+	if err != nil {
+		return beatDown(latency, err)
+	}
+	if len(answers) == 0 {
+		return beatDown(latency, fmt.Errorf("no answer"))
+	}
+
+	beat := &Heartbeat{Status: StatusUp, Latency: latency, Message: strings.Join(answers, ", ")}
+	if proto.Param.Expected != "" {
+		expected := normalizeAnswer(proto.Param.Expected)
+		found := false
+		for _, answer := range answers {
+			found = found || answer == expected
+		}
+		if !found {
+			beat.Status = StatusDown
+			beat.Message = fmt.Sprintf("answer '%s', expected '%s'", beat.Message, expected)
+		}
+	}
+	return beat
+}
+
+func lookupRecord(ctx context.Context, resolver *net.Resolver, record string, host string) ([]string, error) {
+	answers := []string{}
+	switch record {
+	case "", "A", "AAAA":
+		network := "ip4"
+		if record == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, host)
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+		return answers, err
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, host)
+		return append(answers, normalizeAnswer(cname)), err
+	case "MX":
+		mx, err := resolver.LookupMX(ctx, host)
+		for _, r := range mx {
+			answers = append(answers, normalizeAnswer(r.Host))
+		}
+		return answers, err
+	case "NS":
+		ns, err := resolver.LookupNS(ctx, host)
+		for _, r := range ns {
+			answers = append(answers, normalizeAnswer(r.Host))
+		}
+		return answers, err
+	case "TXT":
+		return resolver.LookupTXT(ctx, host)
+	default:
+		return nil, fmt.Errorf("record '%s' is not supported", record)
+	}
+}
+
+func normalizeAnswer(answer string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(answer), "."))
+}
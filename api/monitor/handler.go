@@ -0,0 +1,575 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/api/auth"
+	"github.com/touno-io/core/api/secret"
+	"github.com/touno-io/core/db"
+)
+
+type RequestMonitor struct {
+	Name      string            `json:"name"`
+	Heartbeat int               `json:"heartbeat"`
+	Mobile    bool              `json:"mobile"`
+	Email     bool              `json:"email"`
+	Threshold int               `json:"threshold"`
+	Section   int64             `json:"section"`
+	Public    bool              `json:"public"`
+	Slug      string            `json:"slug"`
+	Protocols []RequestProtocol `json:"protocols"`
+}
+
+type RequestProtocol struct {
+	Host     string        `json:"host"`
+	Port     int           `json:"port"`
+	Type     string        `json:"type"`
+	Param    ProtocolParam `json:"param"`
+	Interval int           `json:"interval"`
+	Timeout  int           `json:"timeout"`
+}
+
+type Monitor struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`
+	Heartbeat int64              `json:"heartbeat"`
+	Mobile    bool               `json:"mobile"`
+	Email     bool               `json:"email"`
+	Paused    bool               `json:"paused"`
+	Threshold int64              `json:"threshold"`
+	Section   int64              `json:"section,omitempty"`
+	Public    bool               `json:"public"`
+	Slug      string             `json:"slug,omitempty"`
+	Protocols []*MonitorProtocol `json:"protocols"`
+	Created   time.Time          `json:"created"`
+}
+
+type MonitorProtocol struct {
+	ID       int64         `json:"id"`
+	Host     string        `json:"host"`
+	Port     int64         `json:"port"`
+	Type     string        `json:"type"`
+	Param    ProtocolParam `json:"param"`
+	Interval int64         `json:"interval"`
+	Timeout  int64         `json:"timeout"`
+	Token    string        `json:"token,omitempty"`
+	Created  time.Time     `json:"created"`
+}
+
+// monitorHandler begin transaction with id of signed in user, every monitor is owned by its user.
+func monitorHandler(pgx *db.PGClient, fn func(c *fiber.Ctx, stx *db.PGTx, userId int64) error) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		userId, err := api.QueryUserID(stx, c.Locals("claims").(auth.TokenClaims).UUID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return fn(c, stx, userId)
+	}
+}
+
+func throwBadRequest(c *fiber.Ctx, stx *db.PGTx, err error) error {
+	stx.Rollback()
+	return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+}
+
+func throwNotFound(c *fiber.Ctx, stx *db.PGTx, name string, id int) error {
+	stx.Rollback()
+	return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("%s %d not found", name, id))
+}
+
+// checkMonitor is found when monitor is owned by user.
+func checkMonitor(stx *db.PGTx, userId int64, monitorId int) error {
+	_, err := stx.QueryOne(`SELECT id FROM monitor WHERE id = $1 AND user_id = $2;`, monitorId, userId)
+	return err
+}
+
+func HandlerGetMonitor(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return monitorHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		monitors, err := queryMonitors(stx, userId, 0)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(monitors)
+	})
+}
+
+func HandlerGetMonitorByID(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return monitorHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		monitorId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		monitors, err := queryMonitors(stx, userId, monitorId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if len(monitors) == 0 {
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("monitor %d not found", monitorId))
+		}
+		return c.JSON(monitors[0])
+	})
+}
+
+func HandlerAddMonitor(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return monitorHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		req := new(RequestMonitor)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		req.defaults()
+		if err := req.Validate(); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		if err := checkSection(stx, userId, req.Section); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		row, err := stx.QueryOne(`
+			INSERT INTO monitor (s_name, n_heartbeat, b_mobile, b_email, n_threshold, notice_section_id, b_public, s_slug, user_id)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, NULLIF($8, ''), $9)
+			RETURNING id;
+		`, req.Name, req.Heartbeat, req.Mobile, req.Email, req.Threshold, req.Section, req.Public, req.Slug, userId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		for i := range req.Protocols {
+			if _, err := insertProtocol(stx, row.ToInt64("id"), &req.Protocols[i]); db.IsRollback(err, stx) {
+				return api.ThrowInternalServerError(c, err)
+			}
+		}
+
+		monitors, err := queryMonitors(stx, userId, int(row.ToInt64("id")))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(monitors[0])
+	})
+}
+
+func HandlerUpdateMonitor(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return monitorHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		monitorId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestMonitor)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if len(req.Protocols) != 0 {
+			return throwBadRequest(c, stx, fmt.Errorf("protocols must be updated with /protocol"))
+		}
+		req.defaults()
+		if err := req.Validate(); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := checkSection(stx, userId, req.Section); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		return updateMonitor(c, stx, userId, monitorId, `
+			UPDATE monitor SET s_name = $3, n_heartbeat = $4, b_mobile = $5, b_email = $6, n_threshold = $7, notice_section_id = NULLIF($8, 0),
+				b_public = $9, s_slug = NULLIF($10, '')
+			WHERE id = $1 AND user_id = $2 RETURNING id;
+		`, monitorId, userId, req.Name, req.Heartbeat, req.Mobile, req.Email, req.Threshold, req.Section, req.Public, req.Slug)
+	})
+}
+
+func HandlerPauseMonitor(pgx *db.PGClient, paused bool) func(c *fiber.Ctx) error {
+	return monitorHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		monitorId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		// push was not expected while monitor is paused, deadline of resumed push protocol start from now.
+		if !paused {
+			err = stx.Execute(`
+				UPDATE monitor_protocal mp SET t_pushed = NOW()
+				FROM monitor m
+				WHERE m.id = mp.monitor_id AND m.id = $1 AND m.user_id = $2 AND m.b_paused AND mp.e_type = 'PUSH';
+			`, monitorId, userId)
+			if db.IsRollback(err, stx) {
+				return api.ThrowInternalServerError(c, err)
+			}
+		}
+
+		return updateMonitor(c, stx, userId, monitorId, `
+			UPDATE monitor SET b_paused = $3 WHERE id = $1 AND user_id = $2 RETURNING id;
+		`, monitorId, userId, paused)
+	})
+}
+
+func HandlerDeleteMonitor(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return monitorHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		monitorId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		err = checkMonitor(stx, userId, monitorId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "monitor", monitorId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = deleteProtocolHistory(stx, `SELECT id FROM monitor_protocal WHERE monitor_id = $1`, monitorId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		err = stx.Execute(`DELETE FROM monitor_protocal WHERE monitor_id = $1;`, monitorId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = stx.Execute(`DELETE FROM monitor WHERE id = $1 AND user_id = $2;`, monitorId, userId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.SendString("{}")
+	})
+}
+
+func HandlerAddProtocol(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return monitorHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		monitorId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestProtocol)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := req.Validate(); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		err = checkMonitor(stx, userId, monitorId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "monitor", monitorId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if _, err := insertProtocol(stx, int64(monitorId), req); db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		monitors, err := queryMonitors(stx, userId, monitorId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(monitors[0])
+	})
+}
+
+func HandlerUpdateProtocol(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return monitorHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		monitorId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		protocolId, err := c.ParamsInt("protocolId")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestProtocol)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := req.Validate(); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		err = checkMonitor(stx, userId, monitorId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "monitor", monitorId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		// dsn from response is redacted, keep stored password when it was sent back unchanged
+		if req.Param.DSN != "" {
+			row, err := stx.QueryOne(`
+				SELECT COALESCE(o_param->>'dsn', '') dsn FROM monitor_protocal WHERE monitor_id = $1 AND id = $2;
+			`, monitorId, protocolId)
+			if err != nil && err != db.ErrNoRows {
+				stx.Rollback()
+				return api.ThrowInternalServerError(c, err)
+			}
+			if row != nil && row["dsn"] != "" {
+				stored, err := secret.Open(row["dsn"])
+				if db.IsRollback(err, stx) {
+					return api.ThrowInternalServerError(c, err)
+				}
+				if req.Param.DSN == redactDSN(string(stored)) {
+					req.Param.DSN = string(stored)
+				}
+			}
+		}
+		if req.Param.DSN, err = sealDSN(req.Param.DSN); db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		param, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(req.Param)
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		_, err = stx.QueryOne(`
+			UPDATE monitor_protocal SET v_host = $3, n_port = $4, e_type = $5, o_param = $6, n_interval = $7, n_timeout = $8,
+				s_token = CASE WHEN $5 = 'PUSH' THEN COALESCE(s_token, REPLACE(uuid_generate_v4()::text, '-', '')) END
+			WHERE monitor_id = $1 AND id = $2 RETURNING id;
+		`, monitorId, protocolId, req.Host, req.Port, req.Type, param, req.Interval, req.Timeout)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "protocol", protocolId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		monitors, err := queryMonitors(stx, userId, monitorId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(monitors[0])
+	})
+}
+
+func HandlerDeleteProtocol(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return monitorHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		monitorId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		protocolId, err := c.ParamsInt("protocolId")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		err = checkMonitor(stx, userId, monitorId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "monitor", monitorId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = deleteProtocolHistory(stx, `SELECT id FROM monitor_protocal WHERE monitor_id = $1 AND id = $2`, monitorId, protocolId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		_, err = stx.QueryOne(`DELETE FROM monitor_protocal WHERE monitor_id = $1 AND id = $2 RETURNING id;`, monitorId, protocolId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "protocol", protocolId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.SendString("{}")
+	})
+}
+
+// updateMonitor execute query of monitor which is owned by user, query must return id of updated row.
+func updateMonitor(c *fiber.Ctx, stx *db.PGTx, userId int64, monitorId int, query string, args ...any) error {
+	_, err := stx.QueryOne(query, args...)
+	if err == db.ErrNoRows {
+		return throwNotFound(c, stx, "monitor", monitorId)
+	} else if db.IsRollback(err, stx) {
+		return api.ThrowInternalServerError(c, err)
+	}
+
+	monitors, err := queryMonitors(stx, userId, monitorId)
+	if db.IsRollback(err, stx) {
+		return api.ThrowInternalServerError(c, err)
+	}
+
+	if err := stx.Commit(); err != nil {
+		return api.ThrowInternalServerError(c, err)
+	}
+	return c.JSON(monitors[0])
+}
+
+func (req *RequestMonitor) defaults() {
+	if req.Heartbeat == 0 {
+		req.Heartbeat = 15
+	}
+	if req.Threshold == 0 {
+		req.Threshold = 3
+	}
+}
+
+// checkSection is found when section is owned by user, so monitor can not notify section of other user.
+func checkSection(stx *db.PGTx, userId int64, sectionId int64) error {
+	if sectionId == 0 {
+		return nil
+	}
+
+	_, err := stx.QueryOne(`SELECT id FROM notice_section WHERE id = $1 AND user_id = $2 AND t_deleted IS NULL;`, sectionId, userId)
+	if err == db.ErrNoRows {
+		return fmt.Errorf("section %d not found", sectionId)
+	}
+	return err
+}
+
+// deleteProtocolHistory remove every row referencing protocols selected by query.
+func deleteProtocolHistory(stx *db.PGTx, query string, args ...any) error {
+	tables := []string{"monitor_heartbeat", "monitor_heartbeat_hourly", "monitor_heartbeat_daily", "monitor_incident"}
+	for _, table := range tables {
+		err := stx.Execute(fmt.Sprintf(`DELETE FROM %s WHERE monitor_protocal_id IN (%s);`, table, query), args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertProtocol(stx *db.PGTx, monitorId int64, req *RequestProtocol) (int64, error) {
+	dsn, err := sealDSN(req.Param.DSN)
+	if err != nil {
+		return 0, err
+	}
+	req.Param.DSN = dsn
+
+	param, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(req.Param)
+	if err != nil {
+		return 0, err
+	}
+
+	row, err := stx.QueryOne(`
+		INSERT INTO monitor_protocal (monitor_id, v_host, n_port, e_type, o_param, n_interval, n_timeout, s_token)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $4 = 'PUSH' THEN REPLACE(uuid_generate_v4()::text, '-', '') END)
+		RETURNING id;
+	`, monitorId, req.Host, req.Port, req.Type, param, req.Interval, req.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	return row.ToInt64("id"), nil
+}
+
+// queryMonitors fetch monitors of user with protocols, monitorId 0 is all monitors of user.
+func queryMonitors(stx *db.PGTx, userId int64, monitorId int) ([]*Monitor, error) {
+	rows, err := stx.Query(`
+		SELECT id, s_name, n_heartbeat, b_mobile, b_email, b_paused, n_threshold,
+			COALESCE(notice_section_id, 0) notice_section_id, b_public, COALESCE(s_slug, '') s_slug, t_created
+		FROM monitor WHERE user_id = $2 AND ($1 = 0 OR id = $1)
+		ORDER BY id;
+	`, monitorId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	monitors := []*Monitor{}
+	monitorIndex := map[int64]*Monitor{}
+	for rows.Next() {
+		row, err := stx.FetchRow(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		monitor := &Monitor{
+			ID:        row.ToInt64("id"),
+			Name:      row["s_name"],
+			Heartbeat: row.ToInt64("n_heartbeat"),
+			Mobile:    row.ToBoolean("b_mobile"),
+			Email:     row.ToBoolean("b_email"),
+			Paused:    row.ToBoolean("b_paused"),
+			Threshold: row.ToInt64("n_threshold"),
+			Section:   row.ToInt64("notice_section_id"),
+			Public:    row.ToBoolean("b_public"),
+			Slug:      row["s_slug"],
+			Protocols: []*MonitorProtocol{},
+			Created:   row.ToTime("t_created"),
+		}
+		monitors = append(monitors, monitor)
+		monitorIndex[monitor.ID] = monitor
+	}
+
+	protoRows, err := stx.Query(`
+		SELECT mp.id, mp.monitor_id, mp.v_host, mp.n_port, mp.e_type, COALESCE(mp.o_param, '{}'::jsonb) o_param, mp.n_interval, mp.n_timeout,
+			COALESCE(mp.s_token, '') s_token, mp.t_created
+		FROM monitor_protocal mp
+		INNER JOIN monitor m ON m.id = mp.monitor_id
+		WHERE m.user_id = $2 AND ($1 = 0 OR mp.monitor_id = $1)
+		ORDER BY mp.id;
+	`, monitorId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer protoRows.Close()
+
+	for protoRows.Next() {
+		row, err := stx.FetchRow(protoRows)
+		if err != nil {
+			return nil, err
+		}
+
+		monitor, ok := monitorIndex[row.ToInt64("monitor_id")]
+		if !ok {
+			continue
+		}
+
+		proto := &MonitorProtocol{
+			ID:       row.ToInt64("id"),
+			Host:     row["v_host"],
+			Port:     row.ToInt64("n_port"),
+			Type:     row["e_type"],
+			Interval: row.ToInt64("n_interval"),
+			Timeout:  row.ToInt64("n_timeout"),
+			Token:    row["s_token"],
+			Created:  row.ToTime("t_created"),
+		}
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_param"), &proto.Param); err != nil {
+			return nil, err
+		}
+		if proto.Param.DSN != "" {
+			proto.Param.DSN = responseDSN(proto.Param.DSN)
+		}
+		monitor.Protocols = append(monitor.Protocols, proto)
+	}
+	return monitors, nil
+}
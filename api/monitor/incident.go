@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/touno-io/core/api/notice"
+	"github.com/touno-io/core/db"
+)
+
+type incident struct {
+	ID       int64
+	Failures int
+	Message  string
+	Started  time.Time
+}
+
+// transition track consecutive failures and open/resolve incident,
+// notice is sent once when protocol goes down and once when it recovers.
+func (s *Scheduler) transition(j *job, beat *Heartbeat) error {
+	now := time.Now()
+	if beat.Status == StatusUp {
+		j.failures = 0
+		if j.incident == nil {
+			return nil
+		}
+
+		downtime := now.Sub(j.incident.Started)
+		if err := s.resolveIncident(j.incident, now, downtime); err != nil {
+			return err
+		}
+		resolved := j.incident
+		j.incident = nil
+		return s.notify(j.proto, StatusUp, resolved, downtime)
+	}
+
+	j.failures++
+	if j.failures == 1 {
+		j.firstFailure = now
+	}
+
+	if j.incident != nil {
+		j.incident.Failures = j.failures
+		return s.updateIncident(j.incident)
+	}
+
+	if j.failures < j.proto.Threshold {
+		return nil
+	}
+
+	opened, err := s.openIncident(j.proto, j.firstFailure, j.failures, beat.Message)
+	if err != nil {
+		return err
+	}
+	j.incident = opened
+	return s.notify(j.proto, StatusDown, opened, 0)
+}
+
+func (s *Scheduler) notify(proto *Protocol, status string, inc *incident, downtime time.Duration) error {
+	if proto.SectionID == 0 || (!proto.Mobile && !proto.Email) {
+		return nil
+	}
+
+	target := proto.Address()
+	switch proto.Type {
+	case HTTP, KEYWORD:
+		target, _ = proto.URL()
+	case PING, DNS, POSTGRES:
+		target = proto.Host
+	}
+
+	req := &notice.RequestNotice{Subject: fmt.Sprintf("[%s] %s", status, proto.Name), Severity: notice.SeverityInfo}
+	if status == StatusDown {
+		req.Severity = notice.SeverityCritical
+		req.Message = fmt.Sprintf("🔴 %s is %s\n%s %s\nreason: %s\nsince %s (%d failures)",
+			proto.Name, status, proto.Type, target, inc.Message, inc.Started.Format(time.RFC1123Z), inc.Failures)
+	} else {
+		req.Message = fmt.Sprintf("🟢 %s is %s\n%s %s\ndowntime %s",
+			proto.Name, status, proto.Type, target, downtime.Round(time.Second))
+	}
+
+	// b_email allow email provider, b_mobile allow any chat provider
+	return notice.NotifySection(s.pgx, proto.SectionID, req, func(eType string) bool {
+		if eType == notice.EMAIL {
+			return proto.Email
+		}
+		return proto.Mobile
+	})
+}
+
+func (s *Scheduler) openedIncident(protocolId int64) (*incident, error) {
+	stx, err := s.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := stx.QueryOne(`
+		SELECT id, n_failures, s_message, t_started FROM monitor_incident
+		WHERE monitor_protocal_id = $1 AND t_resolved IS NULL
+		ORDER BY t_started DESC LIMIT 1;
+	`, protocolId)
+	if err == db.ErrNoRows {
+		return nil, stx.Commit()
+	} else if db.IsRollback(err, stx) {
+		return nil, err
+	}
+
+	if err := stx.Commit(); err != nil {
+		return nil, err
+	}
+	return &incident{
+		ID:       row.ToInt64("id"),
+		Failures: int(row.ToInt64("n_failures")),
+		Message:  row["s_message"],
+		Started:  row.ToTime("t_started"),
+	}, nil
+}
+
+func (s *Scheduler) openIncident(proto *Protocol, started time.Time, failures int, message string) (*incident, error) {
+	stx, err := s.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := stx.QueryOne(`
+		INSERT INTO monitor_incident (monitor_protocal_id, n_failures, s_message, t_started)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id;
+	`, proto.ID, failures, message, started)
+	if db.IsRollback(err, stx) {
+		return nil, err
+	}
+
+	if err := stx.Commit(); err != nil {
+		return nil, err
+	}
+	return &incident{ID: row.ToInt64("id"), Failures: failures, Message: message, Started: started}, nil
+}
+
+func (s *Scheduler) updateIncident(inc *incident) error {
+	stx, err := s.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	err = stx.Execute(`UPDATE monitor_incident SET n_failures = $2 WHERE id = $1;`, inc.ID, inc.Failures)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	return stx.Commit()
+}
+
+func (s *Scheduler) resolveIncident(inc *incident, resolved time.Time, downtime time.Duration) error {
+	stx, err := s.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	err = stx.Execute(`UPDATE monitor_incident SET t_resolved = $2, n_downtime = $3 WHERE id = $1;`,
+		inc.ID, resolved, int64(downtime.Seconds()))
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	return stx.Commit()
+}
@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var (
+	rxJSONPath      = regexp.MustCompile(`^\$?((\.?[^.\[\]]+)|(\[\d+\]))*$`)
+	rxJSONPathToken = regexp.MustCompile(`([^.\[\]]+)|\[(\d+)\]`)
+)
+
+// ProbeKeyword request like HTTP then assert keyword and value at json_path, json_path is dot notation like '$.data.items[0].status'.
+func ProbeKeyword(proto *Protocol) *Heartbeat {
+	res, beat := probeHTTP(proto)
+	if beat.Status != StatusUp || proto.Param.JSONPath == "" {
+		return beat
+	}
+
+	var body any
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(res.Body(), &body); err != nil {
+		beat.Status = StatusDown
+		beat.Message = fmt.Sprintf("body is not json, %s", err)
+		return beat
+	}
+
+	value, ok := lookupJSONPath(body, proto.Param.JSONPath)
+	if !ok || value == nil {
+		beat.Status = StatusDown
+		beat.Message = fmt.Sprintf("json_path '%s' not found", proto.Param.JSONPath)
+		return beat
+	}
+
+	actual := jsonString(value)
+	if proto.Param.Expected != "" && actual != proto.Param.Expected {
+		beat.Status = StatusDown
+		beat.Message = fmt.Sprintf("json_path '%s' is '%s', expected '%s'", proto.Param.JSONPath, actual, proto.Param.Expected)
+	}
+	return beat
+}
+
+func lookupJSONPath(data any, path string) (any, bool) {
+	path = strings.TrimPrefix(path, "$")
+	for _, token := range rxJSONPathToken.FindAllStringSubmatch(path, -1) {
+		if token[2] != "" {
+			index, _ := strconv.Atoi(token[2])
+			items, ok := data.([]any)
+			if !ok || index >= len(items) {
+				return nil, false
+			}
+			data = items[index]
+			continue
+		}
+
+		object, ok := data.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if data, ok = object[token[1]]; !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+func jsonString(value any) string {
+	if text, ok := value.(string); ok {
+		return text
+	}
+	data, _ := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(value)
+	return data
+}
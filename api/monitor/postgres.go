@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/touno-io/core/api/secret"
+	"github.com/touno-io/core/db"
+)
+
+var rxDSNPassword = regexp.MustCompile(`(password\s*=\s*)('[^']*'|\S+)`)
+
+// ProbePostgres open sealed dsn, connect with it and run 'SELECT 1'.
+func ProbePostgres(proto *Protocol) *Heartbeat {
+	dsn, err := secret.Open(proto.Param.DSN)
+	if err != nil {
+		return beatDown(0, err)
+	}
+	conn, err := sql.Open("postgres", string(dsn))
+	if err != nil {
+		return beatDown(0, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), proto.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	var one int
+	err = conn.QueryRowContext(ctx, "SELECT 1;").Scan(&one)
+	latency := elapsed(start)
+	if err != nil {
+		return beatDown(latency, err)
+	}
+	return &Heartbeat{Status: StatusUp, Latency: latency}
+}
+
+// redactDSN hide password of url or key=value dsn.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		return u.String()
+	}
+	return rxDSNPassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
+
+// sealDSN encrypt dsn with api/secret before it is stored, it is opened by ProbePostgres only.
+func sealDSN(dsn string) (string, error) {
+	if dsn == "" {
+		return "", nil
+	}
+	return secret.Seal([]byte(dsn))
+}
+
+// responseDSN open stored dsn and redact it, dsn which can not be opened is hidden.
+func responseDSN(dsn string) string {
+	plain, err := secret.Open(dsn)
+	if err != nil {
+		db.Errorf("Monitor::DSN %s", err)
+		return "xxxxx"
+	}
+	return redactDSN(string(plain))
+}
+
+// RotateSecrets seal dsn which is stored as plain text and re-wrap dsn which is not sealed by the active key.
+func RotateSecrets(pgx *db.PGClient) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	rows, err := stx.Query(`SELECT id, o_param->>'dsn' dsn FROM monitor_protocal WHERE COALESCE(o_param->>'dsn', '') <> '';`)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	record, err := stx.FetchAll(rows)
+	rows.Close()
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	rotated := 0
+	for _, row := range record {
+		dsn, changed, err := secret.Rewrap(row["dsn"])
+		if db.IsRollback(err, stx) {
+			return err
+		}
+		if !changed {
+			continue
+		}
+
+		err = stx.Execute(`UPDATE monitor_protocal SET o_param = jsonb_set(o_param, '{dsn}', to_jsonb($2::text)) WHERE id = $1;`, row["id"], dsn)
+		if db.IsRollback(err, stx) {
+			return err
+		}
+		rotated++
+	}
+
+	if err := stx.Commit(); err != nil {
+		return err
+	}
+	if rotated > 0 {
+		db.Infof("Monitor::RotateSecrets %d dsn are sealed with active key", rotated)
+	}
+	return nil
+}
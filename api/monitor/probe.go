@@ -0,0 +1,247 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	HTTP     = "HTTP"
+	PORT     = "PORT"
+	PING     = "PING"
+	TLS      = "TLS"
+	KEYWORD  = "KEYWORD"
+	DNS      = "DNS"
+	POSTGRES = "POSTGRES"
+	PUSH     = "PUSH"
+)
+
+const (
+	StatusUp   = "UP"
+	StatusDown = "DOWN"
+)
+
+const (
+	defaultInterval = 60 * time.Second
+	defaultTimeout  = 10 * time.Second
+)
+
+type ProtocolParam struct {
+	Method   string            `json:"method,omitempty"`
+	Path     string            `json:"path,omitempty"`
+	Status   int               `json:"status,omitempty"`
+	Keyword  string            `json:"keyword,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	JSONPath string            `json:"json_path,omitempty"`
+	Expected string            `json:"expected,omitempty"`
+	Days     int               `json:"days,omitempty"`
+	Insecure bool              `json:"insecure,omitempty"`
+	Record   string            `json:"record,omitempty"`
+	Resolver string            `json:"resolver,omitempty"`
+	DSN      string            `json:"dsn,omitempty"`
+	Grace    int               `json:"grace,omitempty"`
+}
+
+type Protocol struct {
+	ID        int64
+	MonitorID int64
+	Name      string
+	Host      string
+	Port      int
+	Type      string
+	Param     ProtocolParam
+	Interval  time.Duration
+	Timeout   time.Duration
+	Heartbeat time.Duration
+	Threshold int
+	SectionID int64
+	Mobile    bool
+	Email     bool
+}
+
+// Heartbeat is the record stored in monitor_heartbeat.o_latency, latency is in milliseconds.
+type Heartbeat struct {
+	Status  string  `json:"status"`
+	Latency float64 `json:"latency"`
+	Code    int     `json:"code,omitempty"`
+	Message string  `json:"message,omitempty"`
+}
+
+func (p *Protocol) Address() string {
+	return net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+}
+
+func (p *Protocol) URL() (string, error) {
+	host := p.Host
+	if !strings.Contains(host, "://") {
+		scheme := "http"
+		if p.Port == 443 {
+			scheme = "https"
+		}
+		host = fmt.Sprintf("%s://%s", scheme, host)
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	if u.Port() == "" && p.Port != 0 {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(p.Port))
+	}
+	if p.Param.Path != "" {
+		u.Path = p.Param.Path
+	}
+	return u.String(), nil
+}
+
+func Probe(proto *Protocol) *Heartbeat {
+	switch proto.Type {
+	case HTTP:
+		return ProbeHTTP(proto)
+	case PORT:
+		return ProbePort(proto)
+	case PING:
+		return ProbePing(proto)
+	case TLS:
+		return ProbeTLS(proto)
+	case KEYWORD:
+		return ProbeKeyword(proto)
+	case DNS:
+		return ProbeDNS(proto)
+	case POSTGRES:
+		return ProbePostgres(proto)
+	default:
+		return beatDown(0, fmt.Errorf("Type '%s'::Not Implemented", proto.Type))
+	}
+}
+
+func ProbeHTTP(proto *Protocol) *Heartbeat {
+	_, beat := probeHTTP(proto)
+	return beat
+}
+
+func probeHTTP(proto *Protocol) (*resty.Response, *Heartbeat) {
+	uri, err := proto.URL()
+	if err != nil {
+		return nil, beatDown(0, err)
+	}
+
+	method := strings.ToUpper(proto.Param.Method)
+	if method == "" {
+		method = resty.MethodGet
+	}
+
+	// certificate is verified unless param.insecure is set, so expired or forged certificate is DOWN.
+	client := resty.New().
+		SetTimeout(proto.Timeout).
+		SetTLSClientConfig(&tls.Config{InsecureSkipVerify: proto.Param.Insecure})
+
+	start := time.Now()
+	res, err := client.R().SetHeaders(proto.Param.Headers).Execute(method, uri)
+	latency := elapsed(start)
+	if err != nil {
+		return nil, beatDown(latency, err)
+	}
+
+	beat := &Heartbeat{Status: StatusUp, Latency: latency, Code: res.StatusCode()}
+	if proto.Param.Status != 0 && res.StatusCode() != proto.Param.Status {
+		beat.Status = StatusDown
+		beat.Message = fmt.Sprintf("status %d, expected %d", res.StatusCode(), proto.Param.Status)
+	} else if proto.Param.Status == 0 && res.StatusCode() >= 400 {
+		beat.Status = StatusDown
+		beat.Message = res.Status()
+	} else if proto.Param.Keyword != "" && !strings.Contains(res.String(), proto.Param.Keyword) {
+		beat.Status = StatusDown
+		beat.Message = fmt.Sprintf("keyword '%s' not found", proto.Param.Keyword)
+	}
+	return res, beat
+}
+
+func ProbePort(proto *Protocol) *Heartbeat {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", proto.Address(), proto.Timeout)
+	latency := elapsed(start)
+	if err != nil {
+		return beatDown(latency, err)
+	}
+	defer conn.Close()
+
+	return &Heartbeat{Status: StatusUp, Latency: latency}
+}
+
+func ProbePing(proto *Protocol) *Heartbeat {
+	addr, err := net.ResolveIPAddr("ip4", proto.Host)
+	if err != nil {
+		return beatDown(0, err)
+	}
+
+	// raw socket, container need CAP_NET_RAW
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return beatDown(0, err)
+	}
+	defer conn.Close()
+
+	id := uint16(os.Getpid() & 0xffff)
+	packet := icmpEcho(id, 1, []byte("touno.io"))
+
+	start := time.Now()
+	if err := conn.SetDeadline(start.Add(proto.Timeout)); err != nil {
+		return beatDown(0, err)
+	}
+	if _, err := conn.WriteTo(packet, addr); err != nil {
+		return beatDown(elapsed(start), err)
+	}
+
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(reply)
+		if err != nil {
+			return beatDown(elapsed(start), err)
+		}
+
+		// echo reply type 0 with our identifier
+		if n >= 8 && reply[0] == 0 && binary.BigEndian.Uint16(reply[4:6]) == id && peer.String() == addr.String() {
+			return &Heartbeat{Status: StatusUp, Latency: elapsed(start)}
+		}
+	}
+}
+
+func icmpEcho(id uint16, seq uint16, data []byte) []byte {
+	packet := new(bytes.Buffer)
+	packet.Write([]byte{8, 0, 0, 0})
+	_ = binary.Write(packet, binary.BigEndian, id)
+	_ = binary.Write(packet, binary.BigEndian, seq)
+	packet.Write(data)
+
+	b := packet.Bytes()
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	sum = (sum >> 16) + (sum & 0xffff)
+	sum += sum >> 16
+	binary.BigEndian.PutUint16(b[2:4], ^uint16(sum))
+	return b
+}
+
+func beatDown(latency float64, err error) *Heartbeat {
+	return &Heartbeat{Status: StatusDown, Latency: latency, Message: err.Error()}
+}
+
+func elapsed(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
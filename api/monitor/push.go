@@ -0,0 +1,99 @@
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const defaultGrace = time.Minute
+
+// HandlerPush receive a ping from cron job, optional query 'msg' and 'latency' (ms) are kept in heartbeat.
+func HandlerPush(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		token := c.Params("token")
+		if token == "" || len(token) > 32 {
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("token not found"))
+		}
+
+		beat := &Heartbeat{Status: StatusUp, Message: c.Query("msg")}
+		if latency := c.Query("latency"); latency != "" {
+			ms, err := strconv.ParseFloat(latency, 64)
+			if err != nil || ms < 0 {
+				return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("latency must be positive number"))
+			}
+			beat.Latency = ms
+		}
+		if runes := []rune(beat.Message); len(runes) > 200 {
+			beat.Message = string(runes[:200])
+		}
+
+		latency, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(beat)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		row, err := stx.QueryOne(`
+			UPDATE monitor_protocal mp SET t_pushed = NOW()
+			FROM monitor m
+			WHERE m.id = mp.monitor_id AND NOT m.b_paused AND mp.e_type = 'PUSH' AND mp.s_token = $1
+			RETURNING mp.id;
+		`, token)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("token not found"))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = stx.Execute(`INSERT INTO monitor_heartbeat (monitor_protocal_id, o_latency) VALUES ($1, $2);`, row.ToInt64("id"), latency)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.SendString("{}")
+	}
+}
+
+// probePush is down when no ping arrived within heartbeat plus grace, a protocol never pushed counts from its creation.
+func (s *Scheduler) probePush(proto *Protocol) *Heartbeat {
+	stx, err := s.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return beatDown(0, err)
+	}
+
+	row, err := stx.QueryOne(`SELECT COALESCE(t_pushed, t_created) t_pushed FROM monitor_protocal WHERE id = $1;`, proto.ID)
+	if err == db.ErrNoRows {
+		stx.Rollback()
+		return beatDown(0, fmt.Errorf("protocol %d not found", proto.ID))
+	} else if db.IsRollback(err, stx) {
+		return beatDown(0, err)
+	}
+	if err := stx.Commit(); err != nil {
+		return beatDown(0, err)
+	}
+
+	grace := defaultGrace
+	if proto.Param.Grace > 0 {
+		grace = time.Duration(proto.Param.Grace) * time.Minute
+	}
+
+	since := time.Since(row.ToTime("t_pushed"))
+	if since > proto.Heartbeat+grace {
+		return &Heartbeat{Status: StatusDown, Message: fmt.Sprintf("no push for %s", since.Truncate(time.Second))}
+	}
+	return &Heartbeat{Status: StatusUp}
+}
@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/touno-io/core/db"
+)
+
+const (
+	MONITOR_RETENTION = "MONITOR_RETENTION"
+)
+
+const (
+	rollupInterval   = 5 * time.Minute
+	defaultRetention = 7
+	minRetention     = 2
+	hourlyRetention  = 30
+)
+
+var sqlRollup = `
+	INSERT INTO %[1]s (monitor_protocal_id, t_bucket, n_total, n_up, n_latency_avg, n_latency_p50, n_latency_p95, n_latency_p99)
+	SELECT
+		monitor_protocal_id, date_trunc('%[2]s', t_created) t_bucket,
+		COUNT(*), COUNT(*) FILTER (WHERE o_latency->>'status' = 'UP'),
+		COALESCE(AVG((o_latency->>'latency')::float8) FILTER (WHERE o_latency->>'status' = 'UP'), 0),
+		COALESCE(percentile_cont(0.50) WITHIN GROUP (ORDER BY (o_latency->>'latency')::float8) FILTER (WHERE o_latency->>'status' = 'UP'), 0),
+		COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY (o_latency->>'latency')::float8) FILTER (WHERE o_latency->>'status' = 'UP'), 0),
+		COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY (o_latency->>'latency')::float8) FILTER (WHERE o_latency->>'status' = 'UP'), 0)
+	FROM monitor_heartbeat
+	WHERE t_created >= date_trunc('%[2]s', NOW() - INTERVAL '1 %[2]s')
+	GROUP BY monitor_protocal_id, date_trunc('%[2]s', t_created)
+	ON CONFLICT (monitor_protocal_id, t_bucket) DO UPDATE SET
+		n_total = excluded.n_total, n_up = excluded.n_up, n_latency_avg = excluded.n_latency_avg,
+		n_latency_p50 = excluded.n_latency_p50, n_latency_p95 = excluded.n_latency_p95, n_latency_p99 = excluded.n_latency_p99;
+`
+
+// getRetention days of raw heartbeat, it must cover previous day for daily rollup.
+func getRetention() int {
+	retention := defaultRetention
+	if os.Getenv(MONITOR_RETENTION) != "" {
+		days, err := strconv.Atoi(os.Getenv(MONITOR_RETENTION))
+		if err != nil {
+			db.Errorf("ENV::MONITOR_RETENTION Atoi %s", err)
+		} else {
+			retention = days
+		}
+	}
+
+	if retention < minRetention {
+		retention = minRetention
+	}
+	return retention
+}
+
+// Rollup summarize current and previous hour/day buckets then prune raw heartbeat past retention.
+func (s *Scheduler) Rollup() error {
+	stx, err := s.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	err = stx.Execute(fmt.Sprintf(sqlRollup, "monitor_heartbeat_hourly", "hour"))
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	err = stx.Execute(fmt.Sprintf(sqlRollup, "monitor_heartbeat_daily", "day"))
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	err = stx.Execute(`DELETE FROM monitor_heartbeat WHERE t_created < NOW() - $1 * INTERVAL '1 day';`, s.retention)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	err = stx.Execute(`DELETE FROM monitor_heartbeat_hourly WHERE t_bucket < NOW() - $1 * INTERVAL '1 day';`, hourlyRetention)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	return stx.Commit()
+}
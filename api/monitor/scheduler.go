@@ -0,0 +1,249 @@
+package monitor
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/db"
+)
+
+// Scheduler probe every monitor_protocal on its own interval and keep heartbeat history.
+type Scheduler struct {
+	pgx            *db.PGClient
+	reloadInterval time.Duration
+	retention      int
+	jobs           map[int64]*job
+	mu             sync.Mutex
+	done           chan struct{}
+}
+
+type job struct {
+	proto        *Protocol
+	stop         chan struct{}
+	failures     int
+	firstFailure time.Time
+	incident     *incident
+}
+
+func SchedulerNew(pgx *db.PGClient) *Scheduler {
+	return &Scheduler{
+		pgx:            pgx,
+		reloadInterval: time.Minute,
+		retention:      getRetention(),
+		jobs:           map[int64]*job{},
+		done:           make(chan struct{}),
+	}
+}
+
+// Start load protocols and reload them in background until Stop.
+func (s *Scheduler) Start() {
+	if err := s.Reload(); err != nil {
+		db.Errorf("Monitor::Reload %s", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.reloadInterval)
+		defer ticker.Stop()
+		rollup := time.NewTicker(rollupInterval)
+		defer rollup.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Reload(); err != nil {
+					db.Errorf("Monitor::Reload %s", err)
+				}
+			case <-rollup.C:
+				if err := s.Rollup(); err != nil {
+					db.Errorf("Monitor::Rollup %s", err)
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop every running probe.
+func (s *Scheduler) Stop() {
+	close(s.done)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, j := range s.jobs {
+		close(j.stop)
+		delete(s.jobs, id)
+	}
+}
+
+// Reload sync running probes with monitor_protocal, changed rows are restarted.
+func (s *Scheduler) Reload() error {
+	protocols, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := map[int64]bool{}
+	for _, proto := range protocols {
+		found[proto.ID] = true
+		if j, ok := s.jobs[proto.ID]; ok {
+			if reflect.DeepEqual(j.proto, proto) {
+				continue
+			}
+			close(j.stop)
+		}
+
+		j := &job{proto: proto, stop: make(chan struct{})}
+		s.jobs[proto.ID] = j
+		go s.run(j)
+	}
+
+	for id, j := range s.jobs {
+		if !found[id] {
+			close(j.stop)
+			delete(s.jobs, id)
+		}
+	}
+	db.Debugf("Monitor::Reload %d protocols", len(s.jobs))
+	return nil
+}
+
+func (s *Scheduler) run(j *job) {
+	ticker := time.NewTicker(j.proto.Interval)
+	defer ticker.Stop()
+
+	opened, err := s.openedIncident(j.proto.ID)
+	if err != nil {
+		db.Errorf("Monitor '%s'::%s", j.proto.Name, err)
+	} else if opened != nil {
+		j.incident = opened
+		j.failures = opened.Failures
+		j.firstFailure = opened.Started
+	}
+
+	s.check(j)
+	for {
+		select {
+		case <-ticker.C:
+			s.check(j)
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+func (s *Scheduler) check(j *job) {
+	var beat *Heartbeat
+	if j.proto.Type == PUSH {
+		beat = s.probePush(j.proto)
+	} else {
+		beat = Probe(j.proto)
+	}
+
+	// push heartbeat is recorded by HandlerPush, only a missing push is recorded here.
+	if j.proto.Type != PUSH || beat.Status == StatusDown {
+		if err := s.record(j.proto, beat); err != nil {
+			db.Errorf("Monitor '%s'::%s", j.proto.Name, err)
+		}
+	}
+	if err := s.transition(j, beat); err != nil {
+		db.Errorf("Monitor '%s'::%s", j.proto.Name, err)
+	}
+}
+
+func (s *Scheduler) record(proto *Protocol, beat *Heartbeat) error {
+	latency, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(beat)
+	if err != nil {
+		return err
+	}
+
+	stx, err := s.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	err = stx.Execute(`INSERT INTO monitor_heartbeat (monitor_protocal_id, o_latency) VALUES ($1, $2);`, proto.ID, string(latency))
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	return stx.Commit()
+}
+
+func (s *Scheduler) load() ([]*Protocol, error) {
+	stx, err := s.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stx.Query(`
+		SELECT
+			mp.id, mp.monitor_id, m.s_name, mp.v_host, mp.n_port, mp.e_type,
+			COALESCE(mp.o_param, '{}'::jsonb) o_param, mp.n_interval, mp.n_timeout,
+			m.n_heartbeat, m.n_threshold, COALESCE(m.notice_section_id, 0) notice_section_id, m.b_mobile, m.b_email
+		FROM monitor_protocal mp
+		INNER JOIN monitor m ON m.id = mp.monitor_id
+		WHERE NOT m.b_paused
+	`)
+	if db.IsRollback(err, stx) {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if db.IsRollback(err, stx) {
+		return nil, err
+	}
+
+	if err := stx.Commit(); err != nil {
+		return nil, err
+	}
+
+	protocols := []*Protocol{}
+	for _, row := range record {
+		proto, err := parseProtocol(row)
+		if err != nil {
+			db.Errorf("Monitor '%s'::%s", row["s_name"], err)
+			continue
+		}
+		protocols = append(protocols, proto)
+	}
+	return protocols, nil
+}
+
+func parseProtocol(row db.PGRow) (*Protocol, error) {
+	proto := &Protocol{
+		ID:        row.ToInt64("id"),
+		MonitorID: row.ToInt64("monitor_id"),
+		Name:      row["s_name"],
+		Host:      row["v_host"],
+		Port:      int(row.ToInt64("n_port")),
+		Type:      row["e_type"],
+		Interval:  time.Duration(row.ToInt64("n_interval")) * time.Second,
+		Timeout:   time.Duration(row.ToInt64("n_timeout")) * time.Second,
+		Heartbeat: time.Duration(row.ToInt64("n_heartbeat")) * time.Minute,
+		Threshold: int(row.ToInt64("n_threshold")),
+		SectionID: row.ToInt64("notice_section_id"),
+		Mobile:    row.ToBoolean("b_mobile"),
+		Email:     row.ToBoolean("b_email"),
+	}
+
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_param"), &proto.Param); err != nil {
+		return nil, err
+	}
+
+	if proto.Interval <= 0 {
+		proto.Interval = defaultInterval
+	}
+	if proto.Timeout <= 0 {
+		proto.Timeout = defaultTimeout
+	}
+	if proto.Threshold <= 0 {
+		proto.Threshold = 1
+	}
+	return proto, nil
+}
@@ -0,0 +1,246 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	StatusPaused  = "PAUSED"
+	StatusUnknown = "UNKNOWN"
+)
+
+const (
+	statusDays      = 90
+	statusIncidents = 5
+)
+
+type StatusPage struct {
+	Title    string           `json:"title"`
+	Status   string           `json:"status"`
+	Monitors []*StatusMonitor `json:"monitors"`
+	Updated  time.Time        `json:"updated"`
+}
+
+type StatusMonitor struct {
+	Name      string            `json:"name"`
+	Slug      string            `json:"slug,omitempty"`
+	Status    string            `json:"status"`
+	Uptime    float64           `json:"uptime"`
+	Days      []*StatusDay      `json:"days"`
+	Incidents []*StatusIncident `json:"incidents"`
+}
+
+type StatusDay struct {
+	Date   string  `json:"date"`
+	Uptime float64 `json:"uptime"`
+	Total  int64   `json:"total"`
+	Level  string  `json:"level"`
+}
+
+type StatusIncident struct {
+	Started  time.Time  `json:"started"`
+	Resolved *time.Time `json:"resolved,omitempty"`
+	Downtime int64      `json:"downtime"`
+	Duration string     `json:"-"`
+}
+
+// statusUnavailable is error of public status, detail of error is logged instead of returned.
+const statusUnavailable = "Status is temporarily unavailable, please try again later."
+
+func HandlerStatusPage(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		page, err := queryStatusPage(pgx, c.Params("slug"))
+		if err != nil {
+			db.Errorf("Monitor::StatusPage %s", err)
+			sentry.CaptureException(err)
+			return c.Status(fiber.StatusInternalServerError).Render("status", fiber.Map{"Title": "Status", "Error": statusUnavailable})
+		}
+		if page == nil {
+			return c.Status(fiber.StatusNotFound).Render("404", fiber.Map{})
+		}
+
+		return c.Render("status", fiber.Map{"Title": page.Title, "Page": page, "Error": ""})
+	}
+}
+
+func HandlerStatusJSON(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		page, err := queryStatusPage(pgx, c.Params("slug"))
+		if err != nil {
+			db.Errorf("Monitor::StatusJSON %s", err)
+			sentry.CaptureException(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(api.HttpErrorPrint(fiber.StatusInternalServerError, statusUnavailable))
+		}
+		if page == nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("status '%s' not found", c.Params("slug")))
+		}
+
+		c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+		return c.JSON(page)
+	}
+}
+
+// queryStatusPage build status of public monitors, slug empty is every public monitor and nil is not found.
+func queryStatusPage(pgx *db.PGClient, slug string) (*StatusPage, error) {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stx.Query(`
+		SELECT
+			m.id, m.s_name, COALESCE(m.s_slug, '') s_slug, m.b_paused,
+			EXISTS (
+				SELECT mi.id FROM monitor_incident mi
+				INNER JOIN monitor_protocal mp ON mp.id = mi.monitor_protocal_id
+				WHERE mp.monitor_id = m.id AND mi.t_resolved IS NULL
+			) b_incident,
+			EXISTS (
+				SELECT hb.monitor_protocal_id FROM monitor_heartbeat hb
+				INNER JOIN monitor_protocal mp ON mp.id = hb.monitor_protocal_id
+				WHERE mp.monitor_id = m.id AND hb.t_created >= NOW() - INTERVAL '1 day'
+			) b_heartbeat
+		FROM monitor m
+		WHERE m.b_public AND ($1 = '' OR m.s_slug = $1)
+		ORDER BY m.s_name;
+	`, slug)
+	if db.IsRollback(err, stx) {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if db.IsRollback(err, stx) {
+		return nil, err
+	}
+
+	if slug != "" && len(record) == 0 {
+		return nil, stx.Commit()
+	}
+
+	page := &StatusPage{Title: "Status", Status: StatusUp, Monitors: []*StatusMonitor{}, Updated: time.Now()}
+	for _, row := range record {
+		monitor := &StatusMonitor{Name: row["s_name"], Slug: row["s_slug"], Status: StatusUnknown}
+		switch {
+		case row.ToBoolean("b_paused"):
+			monitor.Status = StatusPaused
+		case row.ToBoolean("b_incident"):
+			monitor.Status = StatusDown
+			page.Status = StatusDown
+		case row.ToBoolean("b_heartbeat"):
+			monitor.Status = StatusUp
+		}
+
+		if monitor.Days, monitor.Uptime, err = queryStatusDays(stx, row.ToInt64("id")); db.IsRollback(err, stx) {
+			return nil, err
+		}
+		if monitor.Incidents, err = queryStatusIncidents(stx, row.ToInt64("id")); db.IsRollback(err, stx) {
+			return nil, err
+		}
+		page.Monitors = append(page.Monitors, monitor)
+	}
+
+	if err := stx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if slug != "" {
+		page.Title = fmt.Sprintf("%s Status", page.Monitors[0].Name)
+	}
+	return page, nil
+}
+
+func queryStatusDays(stx *db.PGTx, monitorId int64) ([]*StatusDay, float64, error) {
+	rows, err := stx.Query(`
+		SELECT to_char(ro.t_bucket, 'YYYY-MM-DD') s_date, SUM(ro.n_total) n_total, SUM(ro.n_up) n_up
+		FROM monitor_heartbeat_daily ro
+		INNER JOIN monitor_protocal mp ON mp.id = ro.monitor_protocal_id
+		WHERE mp.monitor_id = $1 AND ro.t_bucket >= date_trunc('day', NOW()) - $2 * INTERVAL '1 day'
+		GROUP BY to_char(ro.t_bucket, 'YYYY-MM-DD');
+	`, monitorId, statusDays-1)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	daily := map[string]db.PGRow{}
+	for _, row := range record {
+		daily[row["s_date"]] = row
+	}
+
+	var total, up int64
+	days := []*StatusDay{}
+	now := time.Now()
+	for i := statusDays - 1; i >= 0; i-- {
+		day := &StatusDay{Date: now.AddDate(0, 0, -i).Format("2006-01-02"), Level: "none"}
+		if row, ok := daily[day.Date]; ok && row.ToInt64("n_total") > 0 {
+			day.Total = row.ToInt64("n_total")
+			day.Uptime = percent(row.ToInt64("n_up"), day.Total)
+			total += day.Total
+			up += row.ToInt64("n_up")
+
+			switch {
+			case day.Uptime >= 99.9:
+				day.Level = "up"
+			case day.Uptime >= 95:
+				day.Level = "degraded"
+			default:
+				day.Level = "down"
+			}
+		}
+		days = append(days, day)
+	}
+	return days, percent(up, total), nil
+}
+
+func queryStatusIncidents(stx *db.PGTx, monitorId int64) ([]*StatusIncident, error) {
+	rows, err := stx.Query(`
+		SELECT mi.t_started, mi.t_resolved, mi.n_downtime
+		FROM monitor_incident mi
+		INNER JOIN monitor_protocal mp ON mp.id = mi.monitor_protocal_id
+		WHERE mp.monitor_id = $1 AND mi.t_started >= NOW() - $2 * INTERVAL '1 day'
+		ORDER BY mi.t_started DESC LIMIT $3;
+	`, monitorId, statusDays, statusIncidents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	incidents := []*StatusIncident{}
+	for _, row := range record {
+		inc := &StatusIncident{Started: row.ToTime("t_started"), Downtime: row.ToInt64("n_downtime")}
+		if row["t_resolved"] != "" {
+			resolved := row.ToTime("t_resolved")
+			inc.Resolved = &resolved
+			inc.Duration = (time.Duration(inc.Downtime) * time.Second).String()
+		} else {
+			inc.Duration = fmt.Sprintf("ongoing %s", time.Since(inc.Started).Round(time.Minute))
+		}
+		incidents = append(incidents, inc)
+	}
+	return incidents, nil
+}
+
+func percent(n int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(total)*100000) / 1000
+}
@@ -0,0 +1,53 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+const defaultCertDays = 14
+
+// ProbeTLS handshake with host and down when certificate expire within param days.
+func ProbeTLS(proto *Protocol) *Heartbeat {
+	port := proto.Port
+	if port == 0 {
+		port = 443
+	}
+	address := (&Protocol{Host: proto.Host, Port: port}).Address()
+
+	start := time.Now()
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: proto.Timeout}, "tcp", address, &tls.Config{
+		ServerName:         proto.Host,
+		InsecureSkipVerify: proto.Param.Insecure,
+	})
+	latency := elapsed(start)
+	if err != nil {
+		return beatDown(latency, err)
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return beatDown(latency, fmt.Errorf("certificate not found"))
+	}
+
+	days := proto.Param.Days
+	if days <= 0 {
+		days = defaultCertDays
+	}
+
+	notAfter := certs[0].NotAfter
+	remain := int(math.Floor(time.Until(notAfter).Hours() / 24))
+	beat := &Heartbeat{
+		Status:  StatusUp,
+		Latency: latency,
+		Message: fmt.Sprintf("certificate expires in %d days (%s)", remain, notAfter.Format(time.RFC1123Z)),
+	}
+	if remain < days {
+		beat.Status = StatusDown
+	}
+	return beat
+}
@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/api/auth"
+	"github.com/touno-io/core/db"
+)
+
+type Uptime struct {
+	Window    string  `json:"window"`
+	Uptime    float64 `json:"uptime"`
+	Total     int64   `json:"total"`
+	Up        int64   `json:"up"`
+	Latency   Latency `json:"latency"`
+	Incidents int64   `json:"incidents"`
+}
+
+type Latency struct {
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+type uptimeWindow struct {
+	Name     string
+	Interval string
+	Table    string
+}
+
+// 24h is exact from raw heartbeat, longer window is approximated from rollup weighted by heartbeat up.
+var uptimeWindows = []uptimeWindow{
+	{Name: "24h", Interval: "24 hours", Table: ""},
+	{Name: "7d", Interval: "7 days", Table: "monitor_heartbeat_hourly"},
+	{Name: "30d", Interval: "30 days", Table: "monitor_heartbeat_daily"},
+	{Name: "90d", Interval: "90 days", Table: "monitor_heartbeat_daily"},
+}
+
+const sqlUptimeRaw = `
+	SELECT
+		COUNT(*) n_total, COUNT(*) FILTER (WHERE hb.o_latency->>'status' = 'UP') n_up,
+		COALESCE(AVG((hb.o_latency->>'latency')::float8) FILTER (WHERE hb.o_latency->>'status' = 'UP'), 0) n_latency_avg,
+		COALESCE(percentile_cont(0.50) WITHIN GROUP (ORDER BY (hb.o_latency->>'latency')::float8) FILTER (WHERE hb.o_latency->>'status' = 'UP'), 0) n_latency_p50,
+		COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY (hb.o_latency->>'latency')::float8) FILTER (WHERE hb.o_latency->>'status' = 'UP'), 0) n_latency_p95,
+		COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY (hb.o_latency->>'latency')::float8) FILTER (WHERE hb.o_latency->>'status' = 'UP'), 0) n_latency_p99
+	FROM monitor_heartbeat hb
+	INNER JOIN monitor_protocal mp ON mp.id = hb.monitor_protocal_id
+	WHERE mp.monitor_id = $1 AND hb.t_created >= NOW() - $2::interval
+`
+
+const sqlUptimeRollup = `
+	SELECT
+		COALESCE(SUM(ro.n_total), 0) n_total, COALESCE(SUM(ro.n_up), 0) n_up,
+		COALESCE(SUM(ro.n_latency_avg * ro.n_up) / NULLIF(SUM(ro.n_up), 0), 0) n_latency_avg,
+		COALESCE(SUM(ro.n_latency_p50 * ro.n_up) / NULLIF(SUM(ro.n_up), 0), 0) n_latency_p50,
+		COALESCE(SUM(ro.n_latency_p95 * ro.n_up) / NULLIF(SUM(ro.n_up), 0), 0) n_latency_p95,
+		COALESCE(SUM(ro.n_latency_p99 * ro.n_up) / NULLIF(SUM(ro.n_up), 0), 0) n_latency_p99
+	FROM %s ro
+	INNER JOIN monitor_protocal mp ON mp.id = ro.monitor_protocal_id
+	WHERE mp.monitor_id = $1 AND ro.t_bucket >= NOW() - $2::interval
+`
+
+func HandlerGetUptime(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		monitorId, err := c.ParamsInt("id")
+		if err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+
+		windows := uptimeWindows
+		if c.Query("window") != "" {
+			windows = []uptimeWindow{}
+			for _, w := range uptimeWindows {
+				if w.Name == c.Query("window") {
+					windows = append(windows, w)
+				}
+			}
+			if len(windows) == 0 {
+				return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("window '%s' is not supported", c.Query("window")))
+			}
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		userId, err := api.QueryUserID(stx, c.Locals("claims").(auth.TokenClaims).UUID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = checkMonitor(stx, userId, monitorId)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("monitor %d not found", monitorId))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		uptime := []*Uptime{}
+		for _, w := range windows {
+			data, err := queryUptime(stx, int64(monitorId), w)
+			if db.IsRollback(err, stx) {
+				return api.ThrowInternalServerError(c, err)
+			}
+			uptime = append(uptime, data)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(uptime)
+	}
+}
+
+func queryUptime(stx *db.PGTx, monitorId int64, w uptimeWindow) (*Uptime, error) {
+	query := sqlUptimeRaw
+	if w.Table != "" {
+		query = fmt.Sprintf(sqlUptimeRollup, w.Table)
+	}
+
+	row, err := stx.QueryOne(query, monitorId, w.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	incident, err := stx.QueryOne(`
+		SELECT COUNT(*) n_incident FROM monitor_incident mi
+		INNER JOIN monitor_protocal mp ON mp.id = mi.monitor_protocal_id
+		WHERE mp.monitor_id = $1 AND (mi.t_started >= NOW() - $2::interval OR mi.t_resolved IS NULL);
+	`, monitorId, w.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &Uptime{
+		Window: w.Name,
+		Total:  row.ToInt64("n_total"),
+		Up:     row.ToInt64("n_up"),
+		Latency: Latency{
+			Avg: roundLatency(row.ToFloat64("n_latency_avg")),
+			P50: roundLatency(row.ToFloat64("n_latency_p50")),
+			P95: roundLatency(row.ToFloat64("n_latency_p95")),
+			P99: roundLatency(row.ToFloat64("n_latency_p99")),
+		},
+		Incidents: incident.ToInt64("n_incident"),
+	}
+	data.Uptime = percent(data.Up, data.Total)
+	return data, nil
+}
+
+func roundLatency(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
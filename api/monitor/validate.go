@@ -0,0 +1,231 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	rxSlug      = regexp.MustCompile(`^[a-z0-9]([a-z0-9\-]{0,48}[a-z0-9])?$`)
+	rxHostname  = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9\-.]*[a-zA-Z0-9])?$`)
+	rxHeaderKey = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9a-zA-Z]+$")
+	typeParams  = map[string][]string{
+		HTTP:     {"method", "path", "status", "keyword", "headers", "insecure"},
+		KEYWORD:  {"method", "path", "status", "keyword", "headers", "json_path", "expected", "insecure"},
+		PORT:     {},
+		PING:     {},
+		TLS:      {"days", "insecure"},
+		DNS:      {"record", "resolver", "expected"},
+		POSTGRES: {"dsn"},
+		PUSH:     {"grace"},
+	}
+	httpMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions,
+	}
+)
+
+func (req *RequestMonitor) Validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 50 {
+		return fmt.Errorf("name is required and must be at most 50 characters")
+	}
+	if req.Heartbeat < 0 {
+		return fmt.Errorf("heartbeat must be positive")
+	}
+	if req.Threshold < 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
+	if req.Section < 0 {
+		return fmt.Errorf("section is invalid")
+	}
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if req.Slug != "" && !rxSlug.MatchString(req.Slug) {
+		return fmt.Errorf("slug must be lowercase letters, numbers and '-'")
+	}
+
+	for i := range req.Protocols {
+		if err := req.Protocols[i].Validate(); err != nil {
+			return fmt.Errorf("protocols[%d] %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (req *RequestProtocol) Validate() error {
+	req.Host = strings.TrimSpace(req.Host)
+	req.Type = strings.ToUpper(req.Type)
+	if req.Type == "" {
+		req.Type = HTTP
+	}
+	if req.Type == PUSH && req.Host == "" {
+		req.Host = "push"
+	}
+
+	if req.Host == "" || len(req.Host) > 150 {
+		return fmt.Errorf("host is required and must be at most 150 characters")
+	}
+	if req.Port < 0 || req.Port > 65535 {
+		return fmt.Errorf("port must be between 0 and 65535")
+	}
+	if req.Interval < 0 || req.Timeout < 0 {
+		return fmt.Errorf("interval and timeout must be positive")
+	}
+	if req.Interval > 0 && req.Timeout >= req.Interval {
+		return fmt.Errorf("timeout must be less than interval")
+	}
+
+	allowed, ok := typeParams[req.Type]
+	if !ok {
+		return fmt.Errorf("type '%s' is not supported", req.Type)
+	}
+	if err := validateParam(req, allowed); err != nil {
+		return err
+	}
+
+	switch req.Type {
+	case HTTP:
+		return validateHTTP(req)
+	case KEYWORD:
+		if req.Param.Keyword == "" && req.Param.JSONPath == "" {
+			return fmt.Errorf("param.keyword or param.json_path is required for '%s'", req.Type)
+		}
+		if req.Param.JSONPath != "" && !rxJSONPath.MatchString(req.Param.JSONPath) {
+			return fmt.Errorf("param.json_path '%s' is invalid", req.Param.JSONPath)
+		}
+		return validateHTTP(req)
+	case PORT:
+		if req.Port == 0 {
+			return fmt.Errorf("port is required for '%s'", req.Type)
+		}
+		return validateHost(req.Host)
+	case TLS:
+		if req.Param.Days < 0 {
+			return fmt.Errorf("param.days must be positive")
+		}
+		return validateHost(req.Host)
+	case DNS:
+		req.Param.Record = strings.ToUpper(req.Param.Record)
+		valid := req.Param.Record == ""
+		for _, record := range dnsRecords {
+			valid = valid || record == req.Param.Record
+		}
+		if !valid {
+			return fmt.Errorf("param.record '%s' is not supported", req.Param.Record)
+		}
+		if req.Param.Resolver != "" {
+			if _, _, err := net.SplitHostPort(req.Param.Resolver); err != nil {
+				return fmt.Errorf("param.resolver must be 'host:port'")
+			}
+		}
+		return validateHost(req.Host)
+	case POSTGRES:
+		if req.Param.DSN == "" {
+			return fmt.Errorf("param.dsn is required for '%s'", req.Type)
+		}
+		if strings.Contains(req.Param.DSN, "://") {
+			if _, err := pq.ParseURL(req.Param.DSN); err != nil {
+				return fmt.Errorf("param.dsn %s", err)
+			}
+		}
+		return validateHost(req.Host)
+	case PUSH:
+		if req.Port != 0 {
+			return fmt.Errorf("port is not supported for '%s'", req.Type)
+		}
+		if req.Param.Grace < 0 {
+			return fmt.Errorf("param.grace must be positive")
+		}
+		return validateHost(req.Host)
+	default:
+		return validateHost(req.Host)
+	}
+}
+
+func validateHost(host string) error {
+	if net.ParseIP(host) == nil && !rxHostname.MatchString(host) {
+		return fmt.Errorf("host '%s' is invalid", host)
+	}
+	return nil
+}
+
+// validateParam reject param which is not used by protocol type.
+func validateParam(req *RequestProtocol, allowed []string) error {
+	param := req.Param
+	fields := []struct {
+		Name string
+		Set  bool
+	}{
+		{"method", param.Method != ""},
+		{"path", param.Path != ""},
+		{"status", param.Status != 0},
+		{"keyword", param.Keyword != ""},
+		{"headers", len(param.Headers) != 0},
+		{"json_path", param.JSONPath != ""},
+		{"expected", param.Expected != ""},
+		{"days", param.Days != 0},
+		{"insecure", param.Insecure},
+		{"record", param.Record != ""},
+		{"resolver", param.Resolver != ""},
+		{"dsn", param.DSN != ""},
+		{"grace", param.Grace != 0},
+	}
+
+	for _, field := range fields {
+		if !field.Set {
+			continue
+		}
+		valid := false
+		for _, name := range allowed {
+			valid = valid || name == field.Name
+		}
+		if !valid {
+			return fmt.Errorf("param.%s is not supported for '%s'", field.Name, req.Type)
+		}
+	}
+	return nil
+}
+
+func validateHTTP(req *RequestProtocol) error {
+	if strings.Contains(req.Host, "://") {
+		u, err := url.Parse(req.Host)
+		if err != nil {
+			return fmt.Errorf("host %s", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("host '%s' must be http or https url", req.Host)
+		}
+	} else if err := validateHost(req.Host); err != nil {
+		return err
+	}
+
+	param := &req.Param
+	if param.Method != "" {
+		param.Method = strings.ToUpper(param.Method)
+		valid := false
+		for _, method := range httpMethods {
+			valid = valid || method == param.Method
+		}
+		if !valid {
+			return fmt.Errorf("param.method '%s' is not supported", param.Method)
+		}
+	}
+	if param.Path != "" && !strings.HasPrefix(param.Path, "/") {
+		return fmt.Errorf("param.path must start with '/'")
+	}
+	if param.Status != 0 && (param.Status < 100 || param.Status > 599) {
+		return fmt.Errorf("param.status must be between 100 and 599")
+	}
+	for key := range param.Headers {
+		if !rxHeaderKey.MatchString(key) {
+			return fmt.Errorf("param.headers '%s' is invalid header name", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package notice
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	maxAttachment        = 10
+	attachmentSize       = 50 << 20
+	attachmentNameSize   = 255
+	emailAttachmentSize  = 25 << 20
+	telegramPhotoSize    = 10 << 20
+	telegramDocumentSize = 50 << 20
+)
+
+// BodyLimit of notice request with attachments in base64.
+const BodyLimit = attachmentSize*4/3 + 1<<20
+
+// NoticeAttachment data is stored in notice_attachment, o_request keep only metadata.
+type NoticeAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+	// Sent and Skip are result of provider which is recorded in notice_history.
+	Sent bool   `json:"sent,omitempty"`
+	Skip string `json:"skip,omitempty"`
+}
+
+var (
+	attachProviders    = []string{TELEGRAM, EMAIL}
+	telegramPhotoTypes = []string{"image/jpeg", "image/png"}
+)
+
+// errBodyTooLarge notice request is over BodyLimit.
+var errBodyTooLarge = fmt.Errorf("request body must be at most %d MB", BodyLimit>>20)
+
+// limitBody read body stream of notice request up to BodyLimit, chunked body has no content length to check.
+type limitBody struct {
+	reader io.Reader
+	left   int64
+	over   bool
+}
+
+// HandlerBodyLimit reject notice request over BodyLimit by its content length, body of notice is not limited by app
+// and chunked body is checked by limitBody while it is streamed.
+func HandlerBodyLimit(c *fiber.Ctx) error {
+	if c.Request().Header.ContentLength() > BodyLimit {
+		// body is not read, connection can not be reused for next request.
+		c.Context().SetConnectionClose()
+		return api.ErrorHandlerThrow(c, fiber.StatusRequestEntityTooLarge, errBodyTooLarge)
+	}
+	return c.Next()
+}
+
+func noticeBody(c *fiber.Ctx) *limitBody {
+	reader := c.Context().RequestBodyStream()
+	if reader == nil {
+		reader = bytes.NewReader(c.Body())
+	}
+	return &limitBody{reader: reader, left: BodyLimit}
+}
+
+func (b *limitBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		// body of exactly BodyLimit is allowed, one more byte is over.
+		if n, err := b.reader.Read(make([]byte, 1)); n == 0 {
+			return 0, err
+		}
+		b.over = true
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.reader.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
+
+// parseMultipart stream fields message, subject, template, variables (json) and files of field attachment,
+// files are read one by one so request never hold more than the limit of attachments.
+func parseMultipart(c *fiber.Ctx, body io.Reader, req *RequestNotice) error {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return fmt.Errorf("multipart boundary is required")
+	}
+
+	reader := multipart.NewReader(body, boundary)
+	total := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if part.FormName() == "attachment" && part.FileName() != "" {
+			if len(req.Attachments) >= maxAttachment {
+				return fmt.Errorf("attachments must be at most %d files", maxAttachment)
+			}
+			data, err := io.ReadAll(io.LimitReader(part, int64(attachmentSize-total)+1))
+			if err != nil {
+				return err
+			}
+			total += len(data)
+			if total > attachmentSize {
+				return fmt.Errorf("attachments must be at most %d MB", attachmentSize>>20)
+			}
+
+			req.Attachments = append(req.Attachments, &NoticeAttachment{
+				Name:        part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+				Data:        data,
+			})
+			continue
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		switch part.FormName() {
+		case "message":
+			req.Message = string(value)
+		case "subject":
+			req.Subject = string(value)
+		case "template":
+			req.Template = string(value)
+		case "variables":
+			if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(value, &req.Variables); err != nil {
+				return fmt.Errorf("variables %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeAttachments check limit of message and fill metadata from data.
+func normalizeAttachments(attachments []*NoticeAttachment) error {
+	if len(attachments) > maxAttachment {
+		return fmt.Errorf("attachments must be at most %d files", maxAttachment)
+	}
+
+	total := 0
+	for i, attachment := range attachments {
+		attachment.Name = attachmentName(attachment.Name, i)
+		if len(attachment.Data) == 0 {
+			return fmt.Errorf("attachment '%s' is empty", attachment.Name)
+		}
+		total += len(attachment.Data)
+		if total > attachmentSize {
+			return fmt.Errorf("attachments must be at most %d MB", attachmentSize>>20)
+		}
+
+		if attachment.ContentType == "" || attachment.ContentType == "application/octet-stream" {
+			attachment.ContentType = http.DetectContentType(attachment.Data)
+		}
+		mediaType, params, err := mime.ParseMediaType(attachment.ContentType)
+		if err != nil {
+			return fmt.Errorf("attachment '%s' content_type %s", attachment.Name, err)
+		}
+		attachment.ContentType = mime.FormatMediaType(mediaType, params)
+
+		sum := sha256.Sum256(attachment.Data)
+		attachment.Size = len(attachment.Data)
+		attachment.SHA256 = hex.EncodeToString(sum[:])
+		attachment.Sent = false
+		attachment.Skip = ""
+	}
+	return nil
+}
+
+// attachmentName drop directory and control character of file name.
+func attachmentName(name string, index int) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	if name == "" || name == "." || name == "/" {
+		name = fmt.Sprintf("attachment-%d", index+1)
+	}
+	if runes := []rune(name); len(runes) > attachmentNameSize {
+		name = string(runes[len(runes)-attachmentNameSize:])
+	}
+	return name
+}
+
+// insertAttachments store data of message attachments, data is removed from request before o_request is stored.
+func insertAttachments(stx *db.PGTx, messageId string, attachments []*NoticeAttachment, data [][]byte) error {
+	for i, attachment := range attachments {
+		err := stx.Execute(`
+			INSERT INTO notice_attachment (notice_message_id, n_index, s_name, s_content_type, n_size, s_sha256, b_data)
+			VALUES ($1, $2, $3, $4, $5, $6, $7);
+		`, messageId, i, attachment.Name, attachment.ContentType, attachment.Size, attachment.SHA256, data[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAttachments read data of message attachments for provider which can send file.
+func loadAttachments(pgx *db.PGClient, messageId string, attachments []*NoticeAttachment) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	rows, err := stx.Query(`SELECT n_index, b_data FROM notice_attachment WHERE notice_message_id = $1 ORDER BY n_index;`, messageId)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	if err := stx.Commit(); err != nil {
+		return err
+	}
+
+	for _, row := range record {
+		index := int(row.ToInt64("n_index"))
+		if index < len(attachments) {
+			attachments[index].Data = row.ToByte("b_data")
+		}
+	}
+	for _, attachment := range attachments {
+		if len(attachment.Data) == 0 {
+			return fmt.Errorf("attachment '%s' not found", attachment.Name)
+		}
+	}
+	return nil
+}
+
+// pruneAttachments delete data of attachments past retention, message which still has a delivery to send keep it.
+// metadata of attachments is kept in o_request and notice_history.
+func pruneAttachments(pgx *db.PGClient, retention int) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	err = stx.Execute(`
+		DELETE FROM notice_attachment na
+		WHERE na.t_created < NOW() - $1 * INTERVAL '1 day' AND NOT EXISTS (
+			SELECT ob.id FROM notice_outbox ob
+			WHERE ob.notice_message_id = na.notice_message_id AND ob.e_status NOT IN ('SENT', 'DEAD', 'DIGESTED')
+		);
+	`, retention)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	return stx.Commit()
+}
+
+// attachmentHistory metadata and result of attachments for notice_history, nil is NULL when message has no attachment.
+func attachmentHistory(req *RequestNotice) any {
+	if len(req.Attachments) == 0 {
+		return nil
+	}
+	for _, attachment := range req.Attachments {
+		attachment.Data = nil
+	}
+
+	history, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(req.Attachments)
+	if err != nil {
+		return nil
+	}
+	return history
+}
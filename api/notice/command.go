@@ -0,0 +1,387 @@
+package notice
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/lib/pq"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	telegramSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	maxMute              = 7 * 24 * time.Hour
+	maxStatusAlert       = 10
+)
+
+var (
+	rxTelegramSecret = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,256}$`)
+	rxAckID          = regexp.MustCompile(`^[0-9a-f\-]{8,36}$`)
+)
+
+// TelegramUpdate https://core.telegram.org/bots/api#update, only text of message is read.
+type TelegramUpdate struct {
+	UpdateID    int64            `json:"update_id"`
+	Message     *TelegramMessage `json:"message,omitempty"`
+	ChannelPost *TelegramMessage `json:"channel_post,omitempty"`
+}
+
+type TelegramMessage struct {
+	MessageID int64         `json:"message_id"`
+	From      *TelegramUser `json:"from,omitempty"`
+	Chat      TelegramChat  `json:"chat"`
+	Text      string        `json:"text"`
+}
+
+type TelegramUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username,omitempty"`
+}
+
+type TelegramChat struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+// TelegramReply is response of webhook, telegram call the method with it so no request is sent back.
+type TelegramReply struct {
+	Method  string `json:"method"`
+	ChatID  int64  `json:"chat_id"`
+	Text    string `json:"text"`
+	ReplyTo int64  `json:"reply_to_message_id,omitempty"`
+}
+
+// telegramCommand run command of chat on every room of the chat.
+type telegramCommand struct {
+	stx    *db.PGTx
+	userId int64
+	rooms  []int64
+	by     string
+}
+
+// HandlerTelegramWebhook receive update of bot which is set with setWebhook
+// url '<NOTICE_URL>/notice/telegram/<provider id>' and secret_token of provider param webhook_secret.
+// Chat is mapped to rooms of the provider by chatId, commands change only those rooms.
+func HandlerTelegramWebhook(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		providerId, err := c.ParamsInt("id")
+		if err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		row, err := stx.QueryOne(`
+			SELECT user_id, o_param FROM notice_provider WHERE id = $1 AND e_type = 'telegram' AND NOT b_deleted;
+		`, providerId)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("provider %d not found", providerId))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		provider := new(TelegramProvider)
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_param"), provider); err != nil {
+			stx.Rollback()
+			return api.ThrowInternalServerError(c, err)
+		}
+		if err := openSecret(provider); err != nil {
+			stx.Rollback()
+			return api.ThrowInternalServerError(c, err)
+		}
+		token := c.Get(telegramSecretHeader)
+		if provider.WebhookSecret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(provider.WebhookSecret)) != 1 {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusUnauthorized, fmt.Errorf("secret token is invalid"))
+		}
+
+		update := new(TelegramUpdate)
+		if err := c.BodyParser(update); err != nil {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+		message := update.Message
+		if message == nil {
+			message = update.ChannelPost
+		}
+		if message == nil || !strings.HasPrefix(message.Text, "/") {
+			stx.Rollback()
+			return c.JSON(fiber.Map{})
+		}
+
+		rows, err := stx.Query(`
+			SELECT id FROM notice_room WHERE notice_provider_id = $1 AND o_param->>'chatId' = $2 AND NOT b_deleted ORDER BY id;
+		`, providerId, strconv.FormatInt(message.Chat.ID, 10))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		defer rows.Close()
+
+		record, err := stx.FetchAll(rows)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		cmd := &telegramCommand{stx: stx, userId: row.ToInt64("user_id"), rooms: []int64{}, by: "telegram"}
+		for _, room := range record {
+			cmd.rooms = append(cmd.rooms, room.ToInt64("id"))
+		}
+		if message.From != nil {
+			cmd.by = fmt.Sprintf("telegram:%d", message.From.ID)
+			if message.From.Username != "" {
+				cmd.by = "telegram:" + message.From.Username
+			}
+		}
+
+		text, err := cmd.run(message)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.JSON(&TelegramReply{Method: "sendMessage", ChatID: message.Chat.ID, Text: text, ReplyTo: message.MessageID})
+	}
+}
+
+// run command of message text, '/cmd@bot arg' is the same as '/cmd arg'.
+func (cmd *telegramCommand) run(message *TelegramMessage) (string, error) {
+	args := strings.Fields(message.Text)
+	name, _, _ := strings.Cut(strings.ToLower(args[0]), "@")
+	args = args[1:]
+
+	if len(cmd.rooms) == 0 || name == "/start" || name == "/help" {
+		return cmd.help(message.Chat.ID), nil
+	}
+	arg := ""
+	if len(args) > 0 {
+		arg = args[0]
+	}
+
+	switch name {
+	case "/ack":
+		return cmd.ack(strings.ToLower(arg))
+	case "/status":
+		return cmd.status()
+	case "/subscribe":
+		return cmd.subscribe(arg, true)
+	case "/unsubscribe":
+		return cmd.subscribe(arg, false)
+	case "/mute":
+		return cmd.mute(strings.ToLower(arg))
+	case "/unmute":
+		return cmd.mute("off")
+	default:
+		return cmd.help(message.Chat.ID), nil
+	}
+}
+
+func (cmd *telegramCommand) help(chatId int64) string {
+	lines := []string{}
+	if len(cmd.rooms) == 0 {
+		lines = append(lines, fmt.Sprintf("This chat is not a notice room, add a room with chatId %d.", chatId), "")
+	}
+	return strings.Join(append(lines,
+		"/status - subscribed sections and alerts which are not acknowledged",
+		"/ack [id] - acknowledge alert, without id every alert of this chat",
+		"/subscribe <section> - notify this chat of section",
+		"/unsubscribe <section> - stop notify this chat of section",
+		"/mute <30m|1h|1d> - skip message which is not critical, '/mute off' to unmute",
+	), "\n")
+}
+
+// ack stop escalation of alerts which are delivered to the rooms, id is message id or its prefix.
+func (cmd *telegramCommand) ack(id string) (string, error) {
+	if id != "" && !rxAckID.MatchString(id) {
+		return "id must be at least 8 characters of message id, see /status", nil
+	}
+
+	rows, err := cmd.stx.Query(`
+		UPDATE notice_escalation es SET t_ack = NOW(), s_ack = $3, t_next = NULL
+		WHERE es.t_ack IS NULL AND ($2 = '' OR es.notice_message_id::text LIKE $2 || '%')
+			AND EXISTS (
+				SELECT 1 FROM notice_outbox ob
+				WHERE ob.notice_message_id = es.notice_message_id AND ob.notice_room_id = ANY($1)
+			)
+		RETURNING es.notice_message_id;
+	`, pq.Array(cmd.rooms), id, cmd.by)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	record, err := cmd.stx.FetchAll(rows)
+	if err != nil {
+		return "", err
+	}
+	if len(record) == 0 {
+		return "No alert to acknowledge.", nil
+	}
+
+	lines := []string{fmt.Sprintf("Acknowledged %d alerts.", len(record))}
+	for _, row := range record {
+		lines = append(lines, shortID(row["notice_message_id"]))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (cmd *telegramCommand) status() (string, error) {
+	lines := []string{}
+	mute, err := cmd.stx.QueryOne(`SELECT MAX(t_mute) t_mute FROM notice_room WHERE id = ANY($1) AND t_mute > NOW();`, pq.Array(cmd.rooms))
+	if err != nil {
+		return "", err
+	}
+	if mute["t_mute"] != "" {
+		lines = append(lines, fmt.Sprintf("Muted until %s", mute.ToTime("t_mute").Format(time.RFC1123)), "")
+	}
+
+	rows, err := cmd.stx.Query(`
+		SELECT DISTINCT st.s_name, ss.e_severity::text
+		FROM notice_subscriber ss
+		INNER JOIN notice_section st ON st.id = ss.notice_section_id
+		WHERE ss.notice_room_id = ANY($1) AND ss.t_deleted IS NULL AND st.t_deleted IS NULL
+		ORDER BY st.s_name;
+	`, pq.Array(cmd.rooms))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	sections, err := cmd.stx.FetchAll(rows)
+	if err != nil {
+		return "", err
+	}
+	if len(sections) == 0 {
+		lines = append(lines, "No subscribed section.")
+	} else {
+		lines = append(lines, "Sections:")
+	}
+	for _, row := range sections {
+		lines = append(lines, fmt.Sprintf("- %s (%s)", row["s_name"], row["e_severity"]))
+	}
+
+	alertRows, err := cmd.stx.Query(`
+		SELECT es.notice_message_id, st.s_name, COALESCE(msg.o_request->>'subject', '') s_subject, es.t_created
+		FROM notice_escalation es
+		INNER JOIN notice_message msg ON msg.id = es.notice_message_id
+		INNER JOIN notice_section st ON st.id = msg.notice_section_id
+		WHERE es.t_ack IS NULL AND EXISTS (
+			SELECT 1 FROM notice_outbox ob
+			WHERE ob.notice_message_id = es.notice_message_id AND ob.notice_room_id = ANY($1)
+		)
+		ORDER BY es.t_created DESC LIMIT $2;
+	`, pq.Array(cmd.rooms), maxStatusAlert)
+	if err != nil {
+		return "", err
+	}
+	defer alertRows.Close()
+
+	alerts, err := cmd.stx.FetchAll(alertRows)
+	if err != nil {
+		return "", err
+	}
+	if len(alerts) == 0 {
+		lines = append(lines, "", "No alert to acknowledge.")
+	} else {
+		lines = append(lines, "", "Alerts:")
+	}
+	for _, row := range alerts {
+		lines = append(lines, fmt.Sprintf("- %s %s %s %s", shortID(row["notice_message_id"]),
+			row.ToTime("t_created").Format("2006-01-02 15:04"), row["s_name"], truncate(row["s_subject"], digestLineSize)))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// subscribe add or remove rooms of chat to section of provider owner.
+func (cmd *telegramCommand) subscribe(name string, add bool) (string, error) {
+	if name == "" {
+		return "section is required", nil
+	}
+	section, err := cmd.stx.QueryOne(`
+		SELECT id FROM notice_section WHERE user_id = $1 AND s_name = $2 AND t_deleted IS NULL;
+	`, cmd.userId, name)
+	if err == db.ErrNoRows {
+		return fmt.Sprintf("section '%s' not found", name), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if !add {
+		err = cmd.stx.Execute(`
+			UPDATE notice_subscriber SET t_deleted = NOW()
+			WHERE notice_section_id = $1 AND notice_room_id = ANY($2) AND t_deleted IS NULL;
+		`, section["id"], pq.Array(cmd.rooms))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Unsubscribed %s.", name), nil
+	}
+
+	err = cmd.stx.Execute(`
+		INSERT INTO notice_subscriber (notice_section_id, notice_room_id)
+		SELECT $1, room_id FROM UNNEST($2::int[]) room_id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM notice_subscriber
+			WHERE notice_section_id = $1 AND notice_room_id = room_id AND t_deleted IS NULL
+		);
+	`, section["id"], pq.Array(cmd.rooms))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Subscribed %s.", name), nil
+}
+
+// mute skip message which is not critical until the duration ends, 'off' unmute.
+func (cmd *telegramCommand) mute(arg string) (string, error) {
+	if arg == "off" {
+		if err := cmd.stx.Execute(`UPDATE notice_room SET t_mute = NULL WHERE id = ANY($1);`, pq.Array(cmd.rooms)); err != nil {
+			return "", err
+		}
+		return "Unmuted.", nil
+	}
+
+	duration, err := parseMute(arg)
+	if err != nil {
+		return err.Error(), nil
+	}
+	until := time.Now().Add(duration)
+	if err := cmd.stx.Execute(`UPDATE notice_room SET t_mute = $2 WHERE id = ANY($1);`, pq.Array(cmd.rooms), until); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Muted until %s, critical alerts are still sent.", until.UTC().Format(time.RFC1123)), nil
+}
+
+// parseMute duration of time.ParseDuration or days with suffix 'd'.
+func parseMute(arg string) (time.Duration, error) {
+	var duration time.Duration
+	var err error
+	if strings.HasSuffix(arg, "d") {
+		var n int
+		n, err = strconv.Atoi(strings.TrimSuffix(arg, "d"))
+		duration = time.Duration(n) * 24 * time.Hour
+	} else {
+		duration, err = time.ParseDuration(arg)
+	}
+	if err != nil || duration <= 0 || duration > maxMute {
+		return 0, fmt.Errorf("duration must be like 30m, 1h or 1d and at most 7d")
+	}
+	return duration, nil
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,177 @@
+package notice
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// telegramUpdate is an update which telegram sent to the webhook, chat id is replaced.
+const telegramUpdate = `{
+	"update_id": 917364521,
+	"message": {
+		"message_id": 42,
+		"from": {"id": 183422981, "is_bot": false, "first_name": "Kananek", "username": "dvgamer", "language_code": "th"},
+		"chat": {"id": -1001234567890, "title": "touno.io alert", "type": "supergroup"},
+		"date": 1660000000,
+		"text": "/status@touno_bot",
+		"entities": [{"offset": 0, "length": 17, "type": "bot_command"}]
+	}
+}`
+
+func TestParseMute(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30m", 30 * time.Minute, false},
+		{"1h", time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"1d", 24 * time.Hour, false},
+		{"7d", maxMute, false},
+		{"8d", 0, true},
+		{"169h", 0, true},
+		{"0", 0, true},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"d", 0, true},
+		{"abc", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseMute(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseMute() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"0b6f3a1e-5c2d-4c8e-9a51-0d3f2e1b7c90", "0b6f3a1e"},
+		{"0b6f3a1e", "0b6f3a1e"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := shortID(tt.id); got != tt.want {
+			t.Errorf("shortID(%s) = %s, want %s", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestTelegramCommandHelp(t *testing.T) {
+	update := new(TelegramUpdate)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.UnmarshalFromString(telegramUpdate, update); err != nil {
+		t.Fatal(err)
+	}
+	if update.Message == nil || update.Message.Chat.ID != -1001234567890 || update.Message.From.Username != "dvgamer" {
+		t.Fatalf("update %+v is not parsed", update.Message)
+	}
+
+	tests := []struct {
+		name  string
+		text  string
+		rooms []int64
+		want  string
+	}{
+		{"chat without room", "/status@touno_bot", []int64{}, "add a room with chatId -1001234567890"},
+		{"help", "/help", []int64{1}, "/mute <30m|1h|1d>"},
+		{"help with bot name", "/HELP@touno_bot", []int64{1}, "/ack [id]"},
+		{"unknown command", "/weather", []int64{1}, "/subscribe <section>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := *update.Message
+			message.Text = tt.text
+			got, err := (&telegramCommand{rooms: tt.rooms}).run(&message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("run() = %s, want %s", got, tt.want)
+			}
+			if len(tt.rooms) > 0 && strings.Contains(got, "not a notice room") {
+				t.Errorf("run() = %s, chat with room is not a notice room", got)
+			}
+		})
+	}
+}
+
+// TestHandlerTelegramWebhook need postgres, chat of the update has no room so it is answered with help.
+func TestHandlerTelegramWebhook(t *testing.T) {
+	pgx := testPGClient(t)
+
+	var userId, providerId int64
+	email := fmt.Sprintf("telegram-%d@touno.io", time.Now().UnixNano())
+	err := pgx.DB.QueryRow(`
+		INSERT INTO user_account (s_display_name, s_email, n_level) VALUES ('telegram', $1, 'VISITOR') RETURNING id;
+	`, email).Scan(&userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pgx.DB.QueryRow(`
+		INSERT INTO notice_provider (user_id, e_type, o_param) VALUES ($1, 'telegram', $2) RETURNING id;
+	`, userId, `{"token":"bot-token","webhook_secret":"webhook-secret"}`).Scan(&providerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		pgx.DB.Exec(`DELETE FROM notice_provider WHERE id = $1;`, providerId)
+		pgx.DB.Exec(`DELETE FROM user_account WHERE id = $1;`, userId)
+	}()
+
+	app := fiber.New()
+	app.Post("/notice/telegram/:id", HandlerTelegramWebhook(pgx))
+
+	tests := []struct {
+		name   string
+		id     int64
+		secret string
+		body   string
+		status int
+		want   string
+	}{
+		{"provider not found", 0, "webhook-secret", telegramUpdate, fiber.StatusNotFound, ""},
+		{"secret token is invalid", providerId, "other", telegramUpdate, fiber.StatusUnauthorized, ""},
+		{"not a command", providerId, "webhook-secret", strings.Replace(telegramUpdate, "/status@touno_bot", "hello", 1), fiber.StatusOK, "{}"},
+		{"chat without room", providerId, "webhook-secret", telegramUpdate, fiber.StatusOK, `"text":"This chat is not a notice room, add a room with chatId -1001234567890.`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, fmt.Sprintf("/notice/telegram/%d", tt.id), strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			req.Header.Set(telegramSecretHeader, tt.secret)
+
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d %s, want %d", res.StatusCode, body, tt.status)
+			}
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("body = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
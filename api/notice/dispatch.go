@@ -0,0 +1,124 @@
+package notice
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-resty/resty/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/db"
+)
+
+// Deliver send message with provider of the room, return request and response for notice_history,
+// secrets of provider and room are scrubbed from the result. Result of each attachment is set by provider.
+func Deliver(req *RequestNotice, notice db.PGRow) (string, string, error) {
+	reqBody, resBody, err := deliver(req, notice)
+
+	values := secretValues(notice)
+	if err != nil {
+		err = errors.New(scrubSecret(err.Error(), values))
+	}
+	for _, attachment := range req.Attachments {
+		if !contains(attachProviders, notice["e_type"]) {
+			attachment.Skip = fmt.Sprintf("%s does not support attachment", notice["e_type"])
+		}
+		attachment.Skip = scrubSecret(attachment.Skip, values)
+	}
+	return scrubSecret(reqBody, values), scrubSecret(resBody, values), err
+}
+
+func deliver(req *RequestNotice, notice db.PGRow) (string, string, error) {
+	switch notice["e_type"] {
+	case TELEGRAM:
+		return ProviderTelegram(req, notice)
+	case EMAIL:
+		return ProviderEmail(req, notice)
+	case SLACK:
+		return ProviderSlack(req, notice)
+	case MSTEAM:
+		return ProviderMSTeam(req, notice)
+	case LINE:
+		return ProviderLine(req, notice)
+	case LINENOTIFY:
+		return ProviderLineNotify(req, notice)
+	case WORKPLACE:
+		return ProviderWorkplace(req, notice)
+	case WEBHOOK:
+		return ProviderWebhook(req, notice)
+	case NATIVE:
+		return ProviderNative(req, notice)
+	default:
+		return jsonEmpty, jsonEmpty, fmt.Errorf("Not Implemented")
+	}
+}
+
+// NotifySection queue message to every room subscribed to the section,
+// allow filter rooms by provider type and nil is allow all.
+func NotifySection(pgx *db.PGClient, sectionId int64, req *RequestNotice, allow func(eType string) bool) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	res, err := Enqueue(stx, sectionId, req, allow)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	if err := stx.Commit(); err != nil {
+		return err
+	}
+	if res.Suppressed {
+		db.Debugf("Notice::Section %d suppressed duplicated message", sectionId)
+	} else {
+		db.Debugf("Notice::Section %d queued '%s' to %d rooms (%d digest)", sectionId, res.ID, res.Rooms, res.Digest)
+	}
+	return nil
+}
+
+// newClient resty client encode with jsoniter, baseURL is a package variable so provider can be pointed to a stub server.
+func newClient(baseURL string) *resty.Client {
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	client := resty.New().SetBaseURL(baseURL)
+	client.JSONMarshal = json.Marshal
+	client.JSONUnmarshal = json.Unmarshal
+	return client
+}
+
+// senderBody encode request and response of provider for notice_history.
+func senderBody(reqSender any, resSender any) (string, string, error) {
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	reqBody, err := json.Marshal(reqSender)
+	if err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	resBody, err := json.Marshal(resSender)
+	if err != nil {
+		return string(reqBody), jsonEmpty, err
+	}
+	return string(reqBody), string(resBody), nil
+}
+
+// unmarshalNotice decode provider and room o_param with decrypted secrets.
+func unmarshalNotice(notice db.PGRow, provider any, room any) error {
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	if err := json.Unmarshal(notice.ToByte("provider"), provider); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(notice.ToByte("room"), room); err != nil {
+		return err
+	}
+	if err := openSecret(provider); err != nil {
+		return err
+	}
+	return openSecret(room)
+}
+
+// noticeText message for chat provider which has no subject field.
+func noticeText(req *RequestNotice) string {
+	if req.Subject == "" {
+		return req.Message
+	}
+	return fmt.Sprintf("%s\n%s", req.Subject, req.Message)
+}
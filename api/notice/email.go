@@ -1,13 +1,14 @@
 package notice
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"html"
 	"regexp"
 	"strings"
 
-	"github.com/gofiber/fiber/v2"
 	"github.com/touno-io/core/db"
 	gomail "gopkg.in/mail.v2"
 )
@@ -16,10 +17,11 @@ type EmailProvider struct {
 	Port int    `json:"port"`
 	SMTP string `json:"smtp"`
 	User string `json:"username"`
-	Pass string `json:"password"`
+	Pass string `json:"password" secret:"true"`
 }
 
 type EmailRoom struct {
+	Name   string `json:"name,omitempty"`
 	To     string `json:"to"`
 	From   string `json:"from"`
 	Prefix string `json:"subject_prefix"`
@@ -39,33 +41,42 @@ type EmailRoom struct {
 
 // const telegramAPI string = "https://api.telegram.org"
 
-func ProviderEmail(c *fiber.Ctx, notice db.PGRow) (string, string, error) {
+// emailDocument wrap html of template, client which can not show html use the plain text alternative.
+const emailDocument = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>%s</title></head>
+<body>%s</body>
+</html>`
+
+func ProviderEmail(req *RequestNotice, notice db.PGRow) (string, string, error) {
 	email := gomail.NewMessage()
 
 	empty := "{}"
 	provider := new(EmailProvider)
 	room := new(EmailRoom)
-	if err := json.Unmarshal(notice.ToByte("provider"), provider); err != nil {
-		return empty, empty, err
-	}
-	if err := json.Unmarshal(notice.ToByte("room"), room); err != nil {
+	if err := unmarshalNotice(notice, provider, room); err != nil {
 		return empty, empty, err
 	}
 
-	reqHead := c.GetReqHeaders()
-
 	subjectMail := ""
-	if reqHead["Content-Type"] == "text/html" {
-		body := string(c.Body())
+	if req.Source != nil {
+		body, err := formatMessage(req, formatEmail)
+		if err != nil {
+			return empty, empty, err
+		}
+		subjectMail = req.Subject
+		email.SetBody("text/plain", req.Message)
+		email.AddAlternative("text/html", fmt.Sprintf(emailDocument, html.EscapeString(subjectMail), body))
+	} else if req.ContentType == "text/html" {
 		rxtitle := regexp.MustCompile((`<title>.+?<\/`))
-		subjectMail = strings.ReplaceAll(strings.ReplaceAll(rxtitle.FindString(body), `</`, ""), "<title>", "")
-		email.SetBody("text/html", body)
+		subjectMail = strings.ReplaceAll(strings.ReplaceAll(rxtitle.FindString(req.Message), `</`, ""), "<title>", "")
+		email.SetBody("text/html", req.Message)
 	} else {
-		email.SetBody("text/plain", string(c.Body()))
+		email.SetBody("text/plain", req.Message)
 	}
 
-	if reqHead["Subject"] != "" {
-		subjectMail = reqHead["Subject"]
+	if req.Subject != "" {
+		subjectMail = req.Subject
 	}
 
 	email.SetHeader("From", room.From)
@@ -78,11 +89,29 @@ func ProviderEmail(c *fiber.Ctx, notice db.PGRow) (string, string, error) {
 	// email.SetHeader("X-Message-Flag", "Follow up")
 	// email.SetHeader("Importance", "High")
 
+	// attachments are attached in order until size limit of email, the rest is skipped.
+	attached := []*NoticeAttachment{}
+	size := 0
+	for _, attachment := range req.Attachments {
+		if size+attachment.Size > emailAttachmentSize {
+			attachment.Skip = fmt.Sprintf("email attachments must be at most %d MB", emailAttachmentSize>>20)
+			continue
+		}
+		size += attachment.Size
+		attached = append(attached, attachment)
+		email.AttachReader(attachment.Name, bytes.NewReader(attachment.Data),
+			gomail.SetHeader(map[string][]string{"Content-Type": {attachment.ContentType}}))
+	}
+
 	deliver := gomail.NewDialer(provider.SMTP, provider.Port, provider.User, provider.Pass)
 	deliver.TLSConfig = &tls.Config{InsecureSkipVerify: true}
 
 	if err := deliver.DialAndSend(email); err != nil {
-		return empty, `{"error":"` + err.Error() + `"}`, err
+		resBody, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return empty, string(resBody), err
+	}
+	for _, attachment := range attached {
+		attachment.Sent = true
 	}
 
 	return empty, empty, nil
@@ -0,0 +1,352 @@
+package notice
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+// NOTICE_URL is public url of this server for acknowledge link, message has no link when it is not set.
+const NOTICE_URL = "NOTICE_URL"
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+const (
+	maxEscalationStep  = 5
+	maxEscalationAfter = 24 * 60
+	ackTokenSize       = 32
+	// ackExpired is longer than every step of escalation, maxEscalationStep * maxEscalationAfter is 5 days.
+	ackExpired = 7 * 24 * time.Hour
+)
+
+var severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// severityLevel order of severity, unknown is info.
+func severityLevel(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return 0
+}
+
+// NoticeQuiet of subscriber is a daily window in time zone, start after end is a window over midnight.
+// Message which is not critical is held until the window ends.
+type NoticeQuiet struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	TimeZone string `json:"timezone,omitempty"`
+}
+
+// NoticeEscalation of section notify the next room of steps when message at least severity
+// is not acknowledged, after is minutes since the previous step.
+type NoticeEscalation struct {
+	Severity string            `json:"severity,omitempty"`
+	Steps    []*EscalationStep `json:"steps"`
+}
+
+type EscalationStep struct {
+	Room  int64 `json:"room"`
+	After int   `json:"after"`
+}
+
+// NoticeEscalationState of message, step is count of notified steps.
+type NoticeEscalationState struct {
+	Step           int64      `json:"step"`
+	Steps          []int64    `json:"steps"`
+	Next           *time.Time `json:"next,omitempty"`
+	Acknowledged   *time.Time `json:"acknowledged,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+}
+
+// until is end of quiet window when now is inside it, zero time otherwise.
+func (q *NoticeQuiet) until(now time.Time) time.Time {
+	if q == nil {
+		return time.Time{}
+	}
+	loc, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		db.Errorf("Notice::Quiet %s", err)
+		return time.Time{}
+	}
+	start, errStart := parseClock(q.Start)
+	end, errEnd := parseClock(q.End)
+	if errStart != nil || errEnd != nil || start == end {
+		return time.Time{}
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	switch {
+	case start < end && minute >= start && minute < end:
+	case start > end && minute >= start:
+		day = day.AddDate(0, 0, 1)
+	case start > end && minute < end:
+	default:
+		return time.Time{}
+	}
+	return day.Add(time.Duration(end) * time.Minute)
+}
+
+// parseClock minutes since midnight of 15:04.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseQuiet nil is no quiet window.
+func parseQuiet(param []byte) *NoticeQuiet {
+	quiet := new(NoticeQuiet)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(param, quiet); err != nil {
+		db.Errorf("Notice::Quiet %s", err)
+		return nil
+	}
+	if quiet.Start == "" && quiet.End == "" {
+		return nil
+	}
+	return quiet
+}
+
+// quietParam json of quiet for o_quiet, nil is no quiet window.
+func quietParam(quiet *NoticeQuiet) string {
+	if quiet == nil {
+		return jsonEmpty
+	}
+	param, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(quiet)
+	if err != nil {
+		return jsonEmpty
+	}
+	return param
+}
+
+func parseEscalation(param []byte) *NoticeEscalation {
+	escalation := &NoticeEscalation{Steps: []*EscalationStep{}}
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(param, escalation); err != nil {
+		db.Errorf("Notice::Escalation %s", err)
+	}
+	if escalation.Severity == "" {
+		escalation.Severity = SeverityCritical
+	}
+	return escalation
+}
+
+// escalationParam json of escalation for o_escalation, nil keep the stored escalation.
+func escalationParam(escalation *NoticeEscalation) any {
+	if escalation == nil {
+		return nil
+	}
+	param, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(escalation)
+	if err != nil {
+		return nil
+	}
+	return param
+}
+
+func ackURL(token string) string {
+	base := strings.TrimRight(os.Getenv(NOTICE_URL), "/")
+	if base == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/notice/ack/%s", base, token)
+}
+
+// insertEscalation start escalation of message, the first step is due after its minutes.
+func insertEscalation(stx *db.PGTx, messageId string, escalation *NoticeEscalation, hash string) error {
+	steps, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(escalation.Steps)
+	if err != nil {
+		return err
+	}
+	return stx.Execute(`
+		INSERT INTO notice_escalation (notice_message_id, o_steps, s_token, t_next, t_expired)
+		VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 minute', $5);
+	`, messageId, steps, hash, escalation.Steps[0].After, time.Now().Add(ackExpired))
+}
+
+// escalate queue message to the room of every due step which is not acknowledged,
+// escalated delivery is not held by quiet window.
+func escalate(pgx *db.PGClient) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	rows, err := stx.Query(`
+		SELECT id, notice_message_id, o_steps, n_step FROM notice_escalation
+		WHERE t_ack IS NULL AND t_next <= NOW()
+		ORDER BY t_next
+		FOR UPDATE SKIP LOCKED
+	`)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	for _, row := range record {
+		steps := []*EscalationStep{}
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_steps"), &steps); err != nil {
+			db.Errorf("Notice::Escalation %s %s", row["id"], err)
+		}
+
+		step := int(row.ToInt64("n_step"))
+		if step < len(steps) {
+			err = stx.Execute(`INSERT INTO notice_outbox (notice_message_id, notice_room_id) VALUES ($1, $2);`, row["notice_message_id"], steps[step].Room)
+			if db.IsRollback(err, stx) {
+				return err
+			}
+			db.Debugf("Notice::Escalation message %s step %d to room %d", row["notice_message_id"], step+1, steps[step].Room)
+		}
+
+		step++
+		if step < len(steps) {
+			err = stx.Execute(`UPDATE notice_escalation SET n_step = $2, t_next = NOW() + $3 * INTERVAL '1 minute' WHERE id = $1;`,
+				row["id"], step, steps[step].After)
+		} else {
+			err = stx.Execute(`UPDATE notice_escalation SET n_step = $2, t_next = NULL WHERE id = $1;`, row["id"], len(steps))
+		}
+		if db.IsRollback(err, stx) {
+			return err
+		}
+	}
+	return stx.Commit()
+}
+
+// queryEscalation state of message, nil when message has no escalation.
+func queryEscalation(stx *db.PGTx, messageId string) (*NoticeEscalationState, error) {
+	row, err := stx.QueryOne(`
+		SELECT o_steps, n_step, t_next, t_ack, COALESCE(s_ack, '') s_ack FROM notice_escalation WHERE notice_message_id = $1;
+	`, messageId)
+	if err == db.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	steps := []*EscalationStep{}
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_steps"), &steps); err != nil {
+		return nil, err
+	}
+	state := &NoticeEscalationState{Step: row.ToInt64("n_step"), Steps: []int64{}, AcknowledgedBy: row["s_ack"]}
+	for _, step := range steps {
+		state.Steps = append(state.Steps, step.Room)
+	}
+	if row["t_next"] != "" {
+		next := row.ToTime("t_next")
+		state.Next = &next
+	}
+	if row["t_ack"] != "" {
+		ack := row.ToTime("t_ack")
+		state.Acknowledged = &ack
+	}
+	return state, nil
+}
+
+// HandlerAckPage confirm acknowledge of link with a form, so preview of link in chat does not acknowledge.
+func HandlerAckPage(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return renderAck(c, pgx, false)
+	}
+}
+
+// HandlerAckNotice acknowledge message of link, it stop the next escalation steps.
+func HandlerAckNotice(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return renderAck(c, pgx, true)
+	}
+}
+
+func renderAck(c *fiber.Ctx, pgx *db.PGClient, ack bool) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return api.ThrowInternalServerError(c, err)
+	}
+
+	hash := api.HashToken(c.Params("token"))
+	if ack {
+		err = stx.Execute(`
+			UPDATE notice_escalation SET t_ack = NOW(), s_ack = 'link', t_next = NULL
+			WHERE s_token = $1 AND t_ack IS NULL AND t_expired > NOW();
+		`, hash)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+	}
+
+	row, err := stx.QueryOne(`
+		SELECT es.t_ack, st.s_name, msg.o_request
+		FROM notice_escalation es
+		INNER JOIN notice_message msg ON msg.id = es.notice_message_id
+		INNER JOIN notice_section st ON st.id = msg.notice_section_id
+		WHERE es.s_token = $1 AND es.t_expired > NOW();
+	`, hash)
+	if err == db.ErrNoRows {
+		stx.Rollback()
+		return c.Status(fiber.StatusNotFound).Render("notice-ack", fiber.Map{"Title": "Acknowledge", "Error": "Link is invalid or expired"})
+	} else if db.IsRollback(err, stx) {
+		return api.ThrowInternalServerError(c, err)
+	}
+	if err := stx.Commit(); err != nil {
+		return api.ThrowInternalServerError(c, err)
+	}
+
+	req := new(RequestNotice)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_request"), req); err != nil {
+		return api.ThrowInternalServerError(c, err)
+	}
+	data := fiber.Map{
+		"Title":    "Acknowledge",
+		"Section":  row["s_name"],
+		"Subject":  req.Subject,
+		"Severity": req.Severity,
+		"Message":  truncate(req.Message, digestLineSize),
+		"Token":    c.Params("token"),
+	}
+	if row["t_ack"] != "" {
+		data["Acknowledged"] = row.ToTime("t_ack")
+	}
+	return c.Render("notice-ack", data)
+}
+
+// HandlerAckMessage acknowledge message of signed in user.
+func HandlerAckMessage(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		_, err := stx.QueryOne(`
+			UPDATE notice_escalation es SET t_ack = COALESCE(es.t_ack, NOW()), s_ack = COALESCE(es.s_ack, $3), t_next = NULL
+			FROM notice_message msg
+			INNER JOIN notice_section st ON st.id = msg.notice_section_id
+			WHERE msg.id = es.notice_message_id AND msg.id::text = $1 AND st.user_id = $2
+			RETURNING es.id;
+		`, c.Params("id"), userId, fmt.Sprintf("user:%d", userId))
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("escalation of message %s not found", c.Params("id")))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		state, err := queryEscalation(stx, c.Params("id"))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, state)
+	})
+}
@@ -0,0 +1,173 @@
+package notice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietUntil(t *testing.T) {
+	bangkok, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	night := &NoticeQuiet{Start: "22:00", End: "07:00", TimeZone: "Asia/Bangkok"}
+	office := &NoticeQuiet{Start: "09:00", End: "17:00"}
+
+	tests := []struct {
+		name  string
+		quiet *NoticeQuiet
+		now   time.Time
+		want  time.Time
+	}{
+		{"before midnight", night, time.Date(2022, 8, 17, 23, 30, 0, 0, bangkok), time.Date(2022, 8, 18, 7, 0, 0, 0, bangkok)},
+		{"start of window", night, time.Date(2022, 8, 17, 22, 0, 0, 0, bangkok), time.Date(2022, 8, 18, 7, 0, 0, 0, bangkok)},
+		{"after midnight", night, time.Date(2022, 8, 18, 3, 0, 0, 0, bangkok), time.Date(2022, 8, 18, 7, 0, 0, 0, bangkok)},
+		{"end of window", night, time.Date(2022, 8, 18, 7, 0, 0, 0, bangkok), time.Time{}},
+		{"day", night, time.Date(2022, 8, 18, 12, 0, 0, 0, bangkok), time.Time{}},
+		{"time zone of window", night, time.Date(2022, 8, 17, 16, 30, 0, 0, time.UTC), time.Date(2022, 8, 18, 7, 0, 0, 0, bangkok)},
+		{"end of month", night, time.Date(2022, 8, 31, 23, 0, 0, 0, bangkok), time.Date(2022, 9, 1, 7, 0, 0, 0, bangkok)},
+		{"window in a day", office, time.Date(2022, 8, 17, 10, 0, 0, 0, time.UTC), time.Date(2022, 8, 17, 17, 0, 0, 0, time.UTC)},
+		{"before window in a day", office, time.Date(2022, 8, 17, 8, 59, 0, 0, time.UTC), time.Time{}},
+		{"after window in a day", office, time.Date(2022, 8, 17, 17, 0, 0, 0, time.UTC), time.Time{}},
+		{"no window", nil, time.Date(2022, 8, 17, 23, 0, 0, 0, time.UTC), time.Time{}},
+		{"same start and end", &NoticeQuiet{Start: "22:00", End: "22:00"}, time.Date(2022, 8, 17, 22, 0, 0, 0, time.UTC), time.Time{}},
+		{"invalid clock", &NoticeQuiet{Start: "25:00", End: "07:00"}, time.Date(2022, 8, 17, 23, 0, 0, 0, time.UTC), time.Time{}},
+		{"invalid time zone", &NoticeQuiet{Start: "22:00", End: "07:00", TimeZone: "Mars/Base"}, time.Date(2022, 8, 17, 23, 0, 0, 0, time.UTC), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quiet.until(tt.now); !got.Equal(tt.want) {
+				t.Errorf("until(%s) = %s, want %s", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuiet(t *testing.T) {
+	tests := []struct {
+		name  string
+		param string
+		want  *NoticeQuiet
+	}{
+		{"empty", "{}", nil},
+		{"invalid", "[", nil},
+		{"window", `{"start":"22:00","end":"07:00","timezone":"Asia/Bangkok"}`, &NoticeQuiet{"22:00", "07:00", "Asia/Bangkok"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseQuiet([]byte(tt.param))
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("parseQuiet() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeverityLevel(t *testing.T) {
+	tests := []struct {
+		severity string
+		want     int
+	}{
+		{SeverityInfo, 0},
+		{SeverityWarning, 1},
+		{SeverityCritical, 2},
+		{"unknown", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := severityLevel(tt.severity); got != tt.want {
+			t.Errorf("severityLevel(%s) = %d, want %d", tt.severity, got, tt.want)
+		}
+	}
+}
+
+func TestValidateSubscriber(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *RequestSubscriber
+		severity string
+		wantErr  bool
+	}{
+		{"info by default", &RequestSubscriber{}, SeverityInfo, false},
+		{"severity is lower case", &RequestSubscriber{Severity: " Critical "}, SeverityCritical, false},
+		{"quiet over midnight", &RequestSubscriber{Quiet: &NoticeQuiet{Start: "22:00", End: "07:00", TimeZone: "Asia/Bangkok"}}, SeverityInfo, false},
+		{"unknown severity", &RequestSubscriber{Severity: "fatal"}, "", true},
+		{"invalid start", &RequestSubscriber{Quiet: &NoticeQuiet{Start: "10pm", End: "07:00"}}, "", true},
+		{"invalid end", &RequestSubscriber{Quiet: &NoticeQuiet{Start: "22:00", End: "24:00"}}, "", true},
+		{"same start and end", &RequestSubscriber{Quiet: &NoticeQuiet{Start: "22:00", End: "22:00"}}, "", true},
+		{"invalid time zone", &RequestSubscriber{Quiet: &NoticeQuiet{Start: "22:00", End: "07:00", TimeZone: "Mars/Base"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSubscriber(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateSubscriber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.req.Severity != tt.severity {
+				t.Errorf("ValidateSubscriber() severity = %s, want %s", tt.req.Severity, tt.severity)
+			}
+		})
+	}
+}
+
+func TestValidateEscalation(t *testing.T) {
+	tests := []struct {
+		name       string
+		escalation *NoticeEscalation
+		wantErr    bool
+	}{
+		{"not set", nil, false},
+		{"no step", &NoticeEscalation{}, false},
+		{"steps", &NoticeEscalation{Severity: "warning", Steps: []*EscalationStep{{Room: 1, After: 5}, {Room: 2, After: maxEscalationAfter}}}, false},
+		{"unknown severity", &NoticeEscalation{Severity: "fatal"}, true},
+		{"no room", &NoticeEscalation{Steps: []*EscalationStep{{After: 5}}}, true},
+		{"nil step", &NoticeEscalation{Steps: []*EscalationStep{nil}}, true},
+		{"no after", &NoticeEscalation{Steps: []*EscalationStep{{Room: 1}}}, true},
+		{"after is too long", &NoticeEscalation{Steps: []*EscalationStep{{Room: 1, After: maxEscalationAfter + 1}}}, true},
+		{"too many steps", &NoticeEscalation{Steps: make([]*EscalationStep, maxEscalationStep+1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEscalation(tt.escalation)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateEscalation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.escalation != nil && (tt.escalation.Severity == "" || tt.escalation.Steps == nil) {
+				t.Errorf("ValidateEscalation() = %+v, default is not set", tt.escalation)
+			}
+		})
+	}
+}
+
+func TestAckExpired(t *testing.T) {
+	if escalation := time.Duration(maxEscalationStep*maxEscalationAfter) * time.Minute; ackExpired <= escalation {
+		t.Errorf("ackExpired = %s, want longer than escalation %s", ackExpired, escalation)
+	}
+}
+
+func TestAckURL(t *testing.T) {
+	token := "abc"
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{"no link without NOTICE_URL", "", ""},
+		{"link", "https://touno.io", "https://touno.io/notice/ack/" + token},
+		{"trailing slash", "https://touno.io/", "https://touno.io/notice/ack/" + token},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(NOTICE_URL, tt.env)
+			if got := ackURL(token); got != tt.want {
+				t.Errorf("ackURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,13 @@ package notice
 
 import (
 	"fmt"
-	"regexp"
+	"io"
 	"strings"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/api/auth"
 	"github.com/touno-io/core/db"
 )
 
@@ -17,124 +18,143 @@ const (
 	MSTEAM     = "msteam"
 	LINE       = "line"
 	LINENOTIFY = "line-notify"
+	WORKPLACE  = "workplace"
 	EMAIL      = "email"
 	WEBHOOK    = "webhook"
 	NATIVE     = "native"
 )
 
 type RequestNotice struct {
-	Message string `json:"message"`
+	Message     string              `json:"message"`
+	Subject     string              `json:"subject,omitempty"`
+	Metadata    map[string]any      `json:"metadata,omitempty"`
+	ContentType string              `json:"content_type,omitempty"`
+	Template    string              `json:"template,omitempty"`
+	Variables   map[string]any      `json:"variables,omitempty"`
+	DedupKey    string              `json:"dedup_key,omitempty"`
+	Severity    string              `json:"severity,omitempty"`
+	Attachments []*NoticeAttachment `json:"attachments,omitempty"`
+	// Source is template of section which is copied when message is queued.
+	Source *TemplateSource `json:"source,omitempty"`
+	// AckURL stop escalation of message, it is set when section escalate the message.
+	AckURL string `json:"ack_url,omitempty"`
+}
+
+// ResponseNotice rooms is count of queued rooms, digest and quiet are count of them batched into digest
+// or held by quiet hours, filtered is count of subscribers which want a higher severity.
+// Suppressed message is a duplicate which is not stored.
+type ResponseNotice struct {
+	ID         string `json:"id"`
+	Rooms      int    `json:"rooms"`
+	Digest     int    `json:"digest,omitempty"`
+	Quiet      int    `json:"quiet,omitempty"`
+	Filtered   int    `json:"filtered,omitempty"`
+	Suppressed bool   `json:"suppressed,omitempty"`
+	Escalation bool   `json:"escalation,omitempty"`
 }
 
 func HandlerNoticeMessage(pgx *db.PGClient) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
+		courier := c.Locals("courier").(auth.Courier)
 		req := new(RequestNotice)
-		if c.GetReqHeaders()["Content-Type"] == "application/json" {
-			if err := c.BodyParser(req); err != nil {
-				return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		reqHead := c.GetReqHeaders()
+
+		body := noticeBody(c)
+		throwBody := func(err error) error {
+			// rest of body is not read, connection can not be reused for next request.
+			c.Context().SetConnectionClose()
+			if body.over {
+				return api.ErrorHandlerThrow(c, fiber.StatusRequestEntityTooLarge, errBodyTooLarge)
 			}
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+
+		if strings.HasPrefix(reqHead["Content-Type"], fiber.MIMEMultipartForm) {
+			if err := parseMultipart(c, body, req); err != nil {
+				return throwBody(err)
+			}
+		} else {
+			data, err := io.ReadAll(body)
+			if err != nil {
+				return throwBody(err)
+			}
+			if reqHead["Content-Type"] == "application/json" {
+				if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, req); err != nil {
+					return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+				}
+			} else {
+				req.Message = string(data)
+				req.ContentType = reqHead["Content-Type"]
+			}
+		}
+		req.Source = nil
+		req.AckURL = ""
+		if reqHead["Subject"] != "" {
+			req.Subject = reqHead["Subject"]
+		}
+		if reqHead["Dedup-Key"] != "" {
+			req.DedupKey = reqHead["Dedup-Key"]
+		}
+		if reqHead["Severity"] != "" {
+			req.Severity = reqHead["Severity"]
+		}
+		if err := ValidateSeverity(req); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+		if err := normalizeAttachments(req.Attachments); err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
 		}
 
 		stx, err := pgx.Begin(db.LevelDefault)
-		if db.IsRollback(err, stx) {
+		if err != nil {
 			return api.ErrorHandlerThrow(c, fiber.StatusInternalServerError, err)
 		}
 
-		pgNotice, err := stx.Query(`
-			SELECT
-				ss.notice_room_id, pv.e_type, st.n_uuid, pv.o_param provider, sr.o_param room
-			FROM app.notice_section st
-			INNER JOIN app.notice_subscriber ss ON ss.notice_section_id = st.id
-			INNER JOIN app.notice_room sr ON sr.id = ss.notice_room_id
-			INNER JOIN app.notice_provider pv ON pv.id = sr.notice_provider_id
-			WHERE st.cf_courier_app_id = $1::int4 AND st.s_name = $2
-				AND st.t_deleted IS NULL AND NOT pv.b_deleted
-		`, c.Locals("cf_courier_app_id"), c.Params("roomName"))
-
-		if db.IsRollback(err, stx) {
+		section, err := stx.QueryOne(`
+			SELECT id FROM notice_section
+			WHERE user_id = $1 AND s_name = $2 AND t_deleted IS NULL;
+		`, courier.UserID, c.Params("roomName"))
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("%s not found", c.Params("roomName")))
+		} else if db.IsRollback(err, stx) {
 			return api.ErrorHandlerThrow(c, fiber.StatusInternalServerError, err)
 		}
-		defer pgNotice.Close()
-
-		var sqlParam = regexp.MustCompile("(['])")
-		res := new(api.HTTP)
 
-		i := 0
-		errJob := 0
-		var historyInserted []string
-		for pgNotice.Next() {
-			notice, err := stx.FetchRow(pgNotice)
-			if db.IsRollback(err, stx) {
+		if req.Template != "" {
+			tmpl, err := stx.QueryOne(`
+				SELECT s_subject, s_body FROM notice_template
+				WHERE notice_section_id = $1 AND s_name = $2 AND t_deleted IS NULL;
+			`, section.ToInt64("id"), req.Template)
+			if err == db.ErrNoRows {
+				stx.Rollback()
+				return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("template '%s' not found", req.Template))
+			} else if db.IsRollback(err, stx) {
 				return api.ErrorHandlerThrow(c, fiber.StatusInternalServerError, err)
 			}
 
-			go func() {
-				defer func() {
-					if err := recover(); err != nil {
-						db.Error("panic occurred:", err)
-						errJob++
-					}
-				}()
-				var (
-					reqBody string
-					resBody string
-					errMsg  string
-				)
-				switch notice["e_type"] {
-				case TELEGRAM:
-					if reqBody, resBody, err = ProviderTelegram(c, req, notice); db.IsRollbackThrow(err, nil) {
-						errMsg = fmt.Sprintf("Provider '%s'::%s", notice["e_type"], err)
-						res.Error = strings.TrimSpace(fmt.Sprintf("%s\n%s", res.Error, errMsg))
-						db.Error(errMsg)
-					}
-				case EMAIL:
-					if reqBody, resBody, err = ProviderEmail(c, notice); db.IsRollbackThrow(err, nil) {
-						errMsg = fmt.Sprintf("Provider '%s'::%s", notice["e_type"], err)
-						res.Error = strings.TrimSpace(fmt.Sprintf("%s\n%s", res.Error, errMsg))
-						db.Error(errMsg)
-					}
-				default:
-					errMsg = fmt.Sprintf("Provider '%s'::Not Implemented", notice["e_type"])
-					res.Error = strings.TrimSpace(fmt.Sprintf("%s\n%s", res.Error, errMsg))
-					db.Error(errMsg)
-				}
-
-				historyInserted = append(historyInserted, fmt.Sprintf("(%s, '[%s]'::jsonb, %t)",
-					notice["notice_room_id"],
-					strings.Join([]string{sqlParam.ReplaceAllString(reqBody, "'$1"), sqlParam.ReplaceAllString(resBody, "'$1")}, ","), errMsg == ""),
-				)
-				errJob++
-			}()
-			i++
-		}
-
-		if i == 0 {
-			stx.Commit()
-			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("%s not found", c.Params("roomName")))
-		}
-
-		for {
-			time.Sleep(10 * time.Millisecond)
-			if errJob >= i {
-				break
+			if err := req.renderTemplate(&TemplateSource{Subject: tmpl["s_subject"], Body: tmpl["s_body"]}); err != nil {
+				stx.Rollback()
+				return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
 			}
 		}
 
-		if len(historyInserted) != 0 {
-			err = stx.Execute(fmt.Sprintf(`
-			INSERT INTO "app"."notice_history" ("notice_room_id", "o_sender", "b_sended")
-			VALUES %s;
-		`, strings.Join(historyInserted, ",")))
-
-			if db.IsRollback(err, stx) {
-				return api.ErrorHandlerThrow(c, fiber.StatusInternalServerError, err)
-			}
+		res, err := Enqueue(stx, section.ToInt64("id"), req, nil)
+		if db.IsRollback(err, stx) {
+			return api.ErrorHandlerThrow(c, fiber.StatusInternalServerError, err)
+		}
+		if res.Rooms == 0 && !res.Suppressed && res.Filtered == 0 {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("%s has no subscriber", c.Params("roomName")))
 		}
 
-		if err = stx.Commit(); db.IsRollback(err, stx) {
+		if err = stx.Commit(); err != nil {
 			return api.ErrorHandlerThrow(c, fiber.StatusInternalServerError, err)
 		}
 
-		return c.JSON(res)
+		if res.Rooms == 0 {
+			return c.Status(fiber.StatusOK).JSON(res)
+		}
+		return c.Status(fiber.StatusAccepted).JSON(res)
 	}
 }
@@ -0,0 +1,360 @@
+package notice
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/api/auth"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+type NoticeMessage struct {
+	ID         string                 `json:"id"`
+	Section    string                 `json:"section"`
+	Request    RequestNotice          `json:"request"`
+	Deliveries []*NoticeDelivery      `json:"deliveries"`
+	Escalation *NoticeEscalationState `json:"escalation,omitempty"`
+	Created    time.Time              `json:"created"`
+}
+
+type NoticeDelivery struct {
+	ID       int64      `json:"id"`
+	Room     int64      `json:"room"`
+	RoomName string     `json:"room_name,omitempty"`
+	Provider string     `json:"provider"`
+	Status   string     `json:"status"`
+	Attempt  int64      `json:"attempt"`
+	Error    string     `json:"error,omitempty"`
+	Next     *time.Time `json:"next,omitempty"`
+	Sent     *time.Time `json:"sent,omitempty"`
+	// Digest is message which include this delivery.
+	Digest string `json:"digest,omitempty"`
+}
+
+type NoticeHistory struct {
+	ID       int64           `json:"id"`
+	Message  string          `json:"message,omitempty"`
+	Outbox   int64           `json:"outbox,omitempty"`
+	Section  string          `json:"section,omitempty"`
+	Room     int64           `json:"room"`
+	RoomName string          `json:"room_name,omitempty"`
+	Provider string          `json:"provider"`
+	Attempt  int64           `json:"attempt"`
+	Sended   bool            `json:"sended"`
+	Sender   json.RawMessage `json:"sender"`
+	// Attachments metadata with result of provider.
+	Attachments json.RawMessage `json:"attachments,omitempty"`
+	Created     time.Time       `json:"created"`
+}
+
+type HistoryPage struct {
+	Total int64            `json:"total"`
+	Page  int              `json:"page"`
+	Limit int              `json:"limit"`
+	Items []*NoticeHistory `json:"items"`
+}
+
+func HandlerGetMessage(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		userId, err := api.QueryUserID(stx, c.Locals("claims").(auth.TokenClaims).UUID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		row, err := stx.QueryOne(`
+			SELECT msg.id, st.s_name, msg.o_request, msg.t_created
+			FROM notice_message msg
+			INNER JOIN notice_section st ON st.id = msg.notice_section_id
+			WHERE msg.id::text = $1 AND st.user_id = $2;
+		`, c.Params("id"), userId)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("message %s not found", c.Params("id")))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		message := &NoticeMessage{
+			ID:         row["id"],
+			Section:    row["s_name"],
+			Deliveries: []*NoticeDelivery{},
+			Created:    row.ToTime("t_created"),
+		}
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_request"), &message.Request); err != nil {
+			stx.Rollback()
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		rows, err := stx.Query(`
+			SELECT
+				ob.id, ob.notice_room_id, COALESCE(sr.o_param->>'name', '') s_room, pv.e_type, ob.e_status, ob.n_attempt,
+				COALESCE(ob.s_error, '') s_error, ob.t_next, ob.t_sent, COALESCE(ob.notice_digest_id::text, '') digest
+			FROM notice_outbox ob
+			INNER JOIN notice_room sr ON sr.id = ob.notice_room_id
+			INNER JOIN notice_provider pv ON pv.id = sr.notice_provider_id
+			WHERE ob.notice_message_id = $1
+			ORDER BY ob.id;
+		`, message.ID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		defer rows.Close()
+
+		record, err := stx.FetchAll(rows)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		message.Escalation, err = queryEscalation(stx, message.ID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		for _, row := range record {
+			delivery := &NoticeDelivery{
+				ID:       row.ToInt64("id"),
+				Room:     row.ToInt64("notice_room_id"),
+				RoomName: row["s_room"],
+				Provider: row["e_type"],
+				Status:   row["e_status"],
+				Attempt:  row.ToInt64("n_attempt"),
+				Error:    row["s_error"],
+				Digest:   row["digest"],
+			}
+			if delivery.Status == OutboxPending || delivery.Status == OutboxDigest {
+				next := row.ToTime("t_next")
+				delivery.Next = &next
+			}
+			if row["t_sent"] != "" {
+				sent := row.ToTime("t_sent")
+				delivery.Sent = &sent
+			}
+			message.Deliveries = append(message.Deliveries, delivery)
+		}
+		return c.JSON(message)
+	}
+}
+
+// HandlerGetHistory list attempts of rooms owned by user, filter with query
+// message, section, room, provider, success (true/false), from and to (RFC3339 or YYYY-MM-DD), page and limit.
+func HandlerGetHistory(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		page, err := queryInt(c, "page", 1)
+		if err != nil || page < 1 {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("page must be positive"))
+		}
+		limit, err := queryInt(c, "limit", defaultHistoryLimit)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit))
+		}
+
+		where := []string{"pv.user_id = $1"}
+		args := []any{}
+		filter := func(query string, value any) {
+			args = append(args, value)
+			where = append(where, fmt.Sprintf(query, len(args)+1))
+		}
+
+		if c.Query("message") != "" {
+			filter("ob.notice_message_id::text = $%d", c.Query("message"))
+		}
+		if c.Query("section") != "" {
+			filter("st.s_name = $%d", c.Query("section"))
+		}
+		if c.Query("room") != "" {
+			roomId, err := strconv.ParseInt(c.Query("room"), 10, 64)
+			if err != nil {
+				return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("room must be number"))
+			}
+			filter("nh.notice_room_id = $%d", roomId)
+		}
+		if c.Query("provider") != "" {
+			filter("pv.e_type::text = $%d", c.Query("provider"))
+		}
+		if c.Query("success") != "" {
+			success, err := strconv.ParseBool(c.Query("success"))
+			if err != nil {
+				return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("success must be true or false"))
+			}
+			filter("COALESCE(nh.b_sended, false) = $%d", success)
+		}
+		for _, q := range []struct{ Name, Query string }{{"from", "nh.t_created >= $%d"}, {"to", "nh.t_created < $%d"}} {
+			if c.Query(q.Name) == "" {
+				continue
+			}
+			date, err := parseDate(c.Query(q.Name), q.Name == "to")
+			if err != nil {
+				return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("%s %s", q.Name, err))
+			}
+			filter(q.Query, date)
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		userId, err := api.QueryUserID(stx, c.Locals("claims").(auth.TokenClaims).UUID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		args = append([]any{userId}, args...)
+
+		from := `
+			FROM notice_history nh
+			INNER JOIN notice_room sr ON sr.id = nh.notice_room_id
+			INNER JOIN notice_provider pv ON pv.id = sr.notice_provider_id
+			LEFT JOIN notice_outbox ob ON ob.id = nh.notice_outbox_id
+			LEFT JOIN notice_message msg ON msg.id = ob.notice_message_id
+			LEFT JOIN notice_section st ON st.id = msg.notice_section_id
+			WHERE ` + strings.Join(where, " AND ")
+
+		total, err := stx.QueryOne(`SELECT COUNT(*) total `+from, args...)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		rows, err := stx.Query(fmt.Sprintf(`
+			SELECT
+				nh.id, COALESCE(ob.notice_message_id::text, '') message, COALESCE(nh.notice_outbox_id, 0) outbox,
+				COALESCE(st.s_name, '') s_section, nh.notice_room_id, COALESCE(sr.o_param->>'name', '') s_room, pv.e_type,
+				nh.n_attempt, COALESCE(nh.b_sended, false) b_sended, nh.o_sender, nh.o_attachment, nh.t_created
+			%s
+			ORDER BY nh.t_created DESC, nh.id DESC
+			LIMIT %d OFFSET %d
+		`, from, limit, (page-1)*limit), args...)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		defer rows.Close()
+
+		record, err := stx.FetchAll(rows)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		history := &HistoryPage{Total: total.ToInt64("total"), Page: page, Limit: limit, Items: []*NoticeHistory{}}
+		for _, row := range record {
+			history.Items = append(history.Items, &NoticeHistory{
+				ID:          row.ToInt64("id"),
+				Message:     row["message"],
+				Outbox:      row.ToInt64("outbox"),
+				Section:     row["s_section"],
+				Room:        row.ToInt64("notice_room_id"),
+				RoomName:    row["s_room"],
+				Provider:    row["e_type"],
+				Attempt:     row.ToInt64("n_attempt"),
+				Sended:      row.ToBoolean("b_sended"),
+				Sender:      json.RawMessage(row.ToByte("o_sender")),
+				Attachments: json.RawMessage(row.ToByte("o_attachment")),
+				Created:     row.ToTime("t_created"),
+			})
+		}
+		return c.JSON(history)
+	}
+}
+
+// HandlerResendOutbox queue a failed delivery again with full attempts.
+func HandlerResendOutbox(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		outboxId, err := c.ParamsInt("id")
+		if err != nil {
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+		}
+
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		userId, err := api.QueryUserID(stx, c.Locals("claims").(auth.TokenClaims).UUID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		row, err := stx.QueryOne(`
+			SELECT ob.e_status, ob.notice_message_id, COALESCE(ob.s_error, '') s_error, COALESCE(ob.t_leased > NOW(), false) b_leased
+			FROM notice_outbox ob
+			INNER JOIN notice_room sr ON sr.id = ob.notice_room_id
+			INNER JOIN notice_provider pv ON pv.id = sr.notice_provider_id
+			WHERE ob.id = $1 AND pv.user_id = $2
+			FOR UPDATE OF ob;
+		`, outboxId, userId)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("delivery %d not found", outboxId))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if row["e_status"] != OutboxDead && (row["e_status"] != OutboxPending || row["s_error"] == "") {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, fmt.Errorf("delivery %d is %s", outboxId, strings.ToLower(row["e_status"])))
+		}
+		// worker is sending the row, attempt of its lease must not be reset.
+		if row.ToBoolean("b_leased") {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusConflict, fmt.Errorf("delivery %d is being sent", outboxId))
+		}
+
+		err = stx.Execute(`
+			UPDATE notice_outbox SET e_status = 'PENDING', n_attempt = 0, t_next = NOW(), t_leased = NULL WHERE id = $1;
+		`, outboxId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		if err := stx.Commit(); err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return c.Status(fiber.StatusAccepted).JSON(&ResponseNotice{ID: row["notice_message_id"], Rooms: 1})
+	}
+}
+
+// queryUserID user_account id of signed in token.
+// parseDate accept RFC3339 or YYYY-MM-DD, date of 'to' is inclusive.
+func parseDate(value string, end bool) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return date, fmt.Errorf("must be RFC3339 or YYYY-MM-DD")
+	}
+	if end {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+func queryInt(c *fiber.Ctx, name string, value int) (int, error) {
+	if c.Query(name) == "" {
+		return value, nil
+	}
+	return strconv.Atoi(c.Query(name))
+}
@@ -0,0 +1,105 @@
+package notice
+
+import (
+	"fmt"
+
+	"github.com/touno-io/core/db"
+)
+
+type LineProvider struct {
+	Token string `json:"token" secret:"true"`
+}
+type LineRoom struct {
+	Name string `json:"name"`
+	To   string `json:"to"`
+}
+
+type LineMessage struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type LineRequest struct {
+	To       string        `json:"to"`
+	Messages []LineMessage `json:"messages"`
+}
+
+type LineResponse struct {
+	Message string `json:"message,omitempty"`
+	Details []struct {
+		Message  string `json:"message"`
+		Property string `json:"property"`
+	} `json:"details,omitempty"`
+}
+
+type LineNotifyRoom struct {
+	Name  string `json:"name"`
+	Token string `json:"token" secret:"true"`
+}
+
+type LineNotifyRequest struct {
+	Message string `json:"message"`
+}
+
+type LineNotifyResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+var lineAPI string = "https://api.line.me"
+var lineNotifyAPI string = "https://notify-api.line.me"
+
+// ProviderLine push text message with Messaging API, room 'to' is user, group or room id.
+func ProviderLine(req *RequestNotice, notice db.PGRow) (string, string, error) {
+	provider := new(LineProvider)
+	room := new(LineRoom)
+	if err := unmarshalNotice(notice, provider, room); err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	reqSender := &LineRequest{To: room.To, Messages: []LineMessage{{Type: "text", Text: noticeText(req)}}}
+	resSender := &LineResponse{}
+
+	res, errSender := newClient(lineAPI).R().
+		SetAuthToken(provider.Token).
+		SetHeader("Content-Type", "application/json").
+		SetBody(reqSender).SetResult(resSender).SetError(resSender).
+		Post("/v2/bot/message/push")
+
+	reqBody, resBody, err := senderBody(reqSender, resSender)
+	if err != nil {
+		return reqBody, resBody, err
+	}
+
+	if errSender == nil && res.IsError() {
+		errSender = fmt.Errorf("%d %s", res.StatusCode(), resSender.Message)
+	}
+	return reqBody, resBody, errSender
+}
+
+// ProviderLineNotify send with the access token of the room, LINE Notify token is issued per chat.
+func ProviderLineNotify(req *RequestNotice, notice db.PGRow) (string, string, error) {
+	room := new(LineNotifyRoom)
+	if err := unmarshalNotice(notice, &struct{}{}, room); err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	reqSender := &LineNotifyRequest{Message: noticeText(req)}
+	resSender := &LineNotifyResponse{}
+
+	_, errSender := newClient(lineNotifyAPI).R().
+		SetAuthToken(room.Token).
+		SetFormData(map[string]string{"message": reqSender.Message}).
+		SetResult(resSender).SetError(resSender).
+		Post("/api/notify")
+
+	reqBody, resBody, err := senderBody(reqSender, resSender)
+	if err != nil {
+		return reqBody, resBody, err
+	}
+
+	if errSender == nil && resSender.Status != 200 {
+		errSender = fmt.Errorf("%d %s", resSender.Status, resSender.Message)
+	}
+	return reqBody, resBody, errSender
+}
@@ -0,0 +1,1134 @@
+package notice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/api/auth"
+	"github.com/touno-io/core/db"
+)
+
+type RequestProvider struct {
+	Type  string          `json:"type"`
+	Param json.RawMessage `json:"param"`
+}
+
+// RequestRoom policy is kept when it is not set on update.
+type RequestRoom struct {
+	Provider int64           `json:"provider"`
+	Param    json.RawMessage `json:"param"`
+	Policy   *NoticePolicy   `json:"policy"`
+}
+
+// RequestSection policy and escalation are kept when they are not set on update.
+type RequestSection struct {
+	Name       string            `json:"name"`
+	Policy     *NoticePolicy     `json:"policy"`
+	Escalation *NoticeEscalation `json:"escalation"`
+}
+
+// RequestSubscriber severity is minimum severity of message, empty is info.
+type RequestSubscriber struct {
+	Room     int64        `json:"room"`
+	Severity string       `json:"severity"`
+	Quiet    *NoticeQuiet `json:"quiet"`
+}
+
+type RequestTemplate struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+type RequestPreview struct {
+	Variables map[string]any `json:"variables"`
+}
+
+type NoticeProvider struct {
+	ID      int64           `json:"id"`
+	Type    string          `json:"type"`
+	Param   json.RawMessage `json:"param"`
+	Created time.Time       `json:"created"`
+}
+
+type NoticeRoom struct {
+	ID       int64           `json:"id"`
+	Provider int64           `json:"provider"`
+	Type     string          `json:"type"`
+	Param    json.RawMessage `json:"param"`
+	Policy   *NoticePolicy   `json:"policy"`
+	Mute     *time.Time      `json:"mute,omitempty"`
+	Created  time.Time       `json:"created"`
+}
+
+type NoticeSection struct {
+	ID          int64               `json:"id"`
+	Name        string              `json:"name"`
+	UUID        string              `json:"uuid"`
+	Rooms       []int64             `json:"rooms"`
+	Subscribers []*NoticeSubscriber `json:"subscribers"`
+	Policy      *NoticePolicy       `json:"policy"`
+	Escalation  *NoticeEscalation   `json:"escalation"`
+	Created     time.Time           `json:"created"`
+}
+
+type NoticeSubscriber struct {
+	Room     int64        `json:"room"`
+	Severity string       `json:"severity"`
+	Quiet    *NoticeQuiet `json:"quiet,omitempty"`
+}
+
+type NoticeTemplate struct {
+	ID      int64     `json:"id"`
+	Section int64     `json:"section"`
+	Name    string    `json:"name"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Created time.Time `json:"created"`
+}
+
+// NoticePreview subject is plain text and body is rendered in every format.
+type NoticePreview struct {
+	Subject string            `json:"subject"`
+	Body    map[string]string `json:"body"`
+}
+
+type NoticeTest struct {
+	Sended bool            `json:"sended"`
+	Error  string          `json:"error,omitempty"`
+	Sender json.RawMessage `json:"sender"`
+}
+
+// noticeHandler begin transaction with user id of signed in token, fn must commit or rollback stx.
+func noticeHandler(pgx *db.PGClient, fn func(c *fiber.Ctx, stx *db.PGTx, userId int64) error) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		stx, err := pgx.Begin(db.LevelDefault)
+		if err != nil {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		userId, err := api.QueryUserID(stx, c.Locals("claims").(auth.TokenClaims).UUID)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return fn(c, stx, userId)
+	}
+}
+
+func commitJSON(c *fiber.Ctx, stx *db.PGTx, status int, data any) error {
+	if err := stx.Commit(); err != nil {
+		return api.ThrowInternalServerError(c, err)
+	}
+	return c.Status(status).JSON(data)
+}
+
+func throwNotFound(c *fiber.Ctx, stx *db.PGTx, name string, id int) error {
+	stx.Rollback()
+	return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("%s %d not found", name, id))
+}
+
+func throwBadRequest(c *fiber.Ctx, stx *db.PGTx, err error) error {
+	stx.Rollback()
+	return api.ErrorHandlerThrow(c, fiber.StatusBadRequest, err)
+}
+
+// throwParam is bad request of invalid o_param, or internal error when secret can not be sealed.
+func throwParam(c *fiber.Ctx, stx *db.PGTx, err error) error {
+	if errors.Is(err, errSeal) {
+		stx.Rollback()
+		return api.ThrowInternalServerError(c, err)
+	}
+	return throwBadRequest(c, stx, err)
+}
+
+func HandlerGetProvider(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		providers, err := queryProviders(stx, userId, 0)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, providers)
+	})
+}
+
+func HandlerGetProviderByID(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		providerId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		providers, err := queryProviders(stx, userId, providerId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if len(providers) == 0 {
+			return throwNotFound(c, stx, "provider", providerId)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, providers[0])
+	})
+}
+
+func HandlerAddProvider(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		req := new(RequestProvider)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req.Type = strings.ToLower(req.Type)
+		param, err := ValidateProvider(req.Type, req.Param, nil)
+		if err != nil {
+			return throwParam(c, stx, err)
+		}
+
+		row, err := stx.QueryOne(`
+			INSERT INTO notice_provider (user_id, e_type, o_param) VALUES ($1, $2, $3) RETURNING id;
+		`, userId, req.Type, param)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		providers, err := queryProviders(stx, userId, int(row.ToInt64("id")))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusCreated, providers[0])
+	})
+}
+
+// HandlerUpdateProvider replace o_param, type of provider can not be changed because rooms depend on it.
+func HandlerUpdateProvider(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		providerId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestProvider)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		providers, err := queryProviders(stx, userId, providerId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if len(providers) == 0 {
+			return throwNotFound(c, stx, "provider", providerId)
+		}
+
+		eType := providers[0].Type
+		if req.Type != "" && strings.ToLower(req.Type) != eType {
+			return throwBadRequest(c, stx, fmt.Errorf("type of provider can not be changed"))
+		}
+
+		previous, err := stx.QueryOne(`SELECT o_param FROM notice_provider WHERE id = $1;`, providerId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		param, err := ValidateProvider(eType, req.Param, previous.ToByte("o_param"))
+		if err != nil {
+			return throwParam(c, stx, err)
+		}
+
+		err = stx.Execute(`UPDATE notice_provider SET o_param = $2 WHERE id = $1;`, providerId, param)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		providers, err = queryProviders(stx, userId, providerId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, providers[0])
+	})
+}
+
+// HandlerDeleteProvider soft delete provider with its rooms and subscribers.
+func HandlerDeleteProvider(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		providerId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		_, err = stx.QueryOne(`
+			UPDATE notice_provider SET b_deleted = true
+			WHERE id = $1 AND user_id = $2 AND NOT b_deleted RETURNING id;
+		`, providerId, userId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "provider", providerId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = stx.Execute(`
+			UPDATE notice_subscriber SET t_deleted = NOW()
+			WHERE t_deleted IS NULL AND notice_room_id IN (SELECT id FROM notice_room WHERE notice_provider_id = $1);
+		`, providerId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = stx.Execute(`UPDATE notice_room SET b_deleted = true WHERE notice_provider_id = $1 AND NOT b_deleted;`, providerId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, fiber.Map{})
+	})
+}
+
+func HandlerGetRoom(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		rooms, err := queryRooms(stx, userId, 0)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, rooms)
+	})
+}
+
+func HandlerGetRoomByID(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		roomId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		rooms, err := queryRooms(stx, userId, roomId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if len(rooms) == 0 {
+			return throwNotFound(c, stx, "room", roomId)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, rooms[0])
+	})
+}
+
+func HandlerAddRoom(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		req := new(RequestRoom)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		providers, err := queryProviders(stx, userId, int(req.Provider))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if req.Provider <= 0 || len(providers) == 0 {
+			return throwBadRequest(c, stx, fmt.Errorf("provider %d not found", req.Provider))
+		}
+
+		param, err := ValidateRoom(providers[0].Type, req.Param, nil)
+		if err != nil {
+			return throwParam(c, stx, err)
+		}
+		if err := ValidatePolicy(req.Policy); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		row, err := stx.QueryOne(`
+			INSERT INTO notice_room (notice_provider_id, o_param, o_policy) VALUES ($1, $2, COALESCE($3::jsonb, '{}')) RETURNING id;
+		`, req.Provider, param, policyParam(req.Policy))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		rooms, err := queryRooms(stx, userId, int(row.ToInt64("id")))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusCreated, rooms[0])
+	})
+}
+
+// HandlerUpdateRoom replace o_param, room may move to another provider of the same type.
+func HandlerUpdateRoom(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		roomId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestRoom)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		rooms, err := queryRooms(stx, userId, roomId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if len(rooms) == 0 {
+			return throwNotFound(c, stx, "room", roomId)
+		}
+
+		room := rooms[0]
+		if req.Provider != 0 && req.Provider != room.Provider {
+			providers, err := queryProviders(stx, userId, int(req.Provider))
+			if db.IsRollback(err, stx) {
+				return api.ThrowInternalServerError(c, err)
+			}
+			if len(providers) == 0 || providers[0].Type != room.Type {
+				return throwBadRequest(c, stx, fmt.Errorf("provider %d not found or not '%s'", req.Provider, room.Type))
+			}
+			room.Provider = req.Provider
+		}
+
+		previous, err := stx.QueryOne(`SELECT o_param FROM notice_room WHERE id = $1;`, roomId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		param, err := ValidateRoom(room.Type, req.Param, previous.ToByte("o_param"))
+		if err != nil {
+			return throwParam(c, stx, err)
+		}
+		if err := ValidatePolicy(req.Policy); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		err = stx.Execute(`
+			UPDATE notice_room SET notice_provider_id = $2, o_param = $3, o_policy = COALESCE($4::jsonb, o_policy) WHERE id = $1;
+		`, roomId, room.Provider, param, policyParam(req.Policy))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		rooms, err = queryRooms(stx, userId, roomId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, rooms[0])
+	})
+}
+
+// HandlerDeleteRoom soft delete room with its subscribers.
+func HandlerDeleteRoom(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		roomId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		_, err = stx.QueryOne(`
+			UPDATE notice_room sr SET b_deleted = true
+			FROM notice_provider pv
+			WHERE pv.id = sr.notice_provider_id AND sr.id = $1 AND pv.user_id = $2 AND NOT sr.b_deleted
+			RETURNING sr.id;
+		`, roomId, userId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "room", roomId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = stx.Execute(`UPDATE notice_subscriber SET t_deleted = NOW() WHERE notice_room_id = $1 AND t_deleted IS NULL;`, roomId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, fiber.Map{})
+	})
+}
+
+// HandlerTestRoom deliver a message to the room right away without the outbox, the attempt is kept in notice_history.
+func HandlerTestRoom(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		roomId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := &RequestNotice{Subject: "Test message", Message: "This is a test message from touno.io"}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(req); err != nil {
+				return throwBadRequest(c, stx, err)
+			}
+		}
+
+		notice, err := stx.QueryOne(`
+			SELECT sr.id notice_room_id, pv.e_type, pv.o_param provider, sr.o_param room, `+pushSubscriptions+`
+			FROM notice_room sr
+			INNER JOIN notice_provider pv ON pv.id = sr.notice_provider_id
+			WHERE sr.id = $1 AND pv.user_id = $2 AND NOT sr.b_deleted AND NOT pv.b_deleted;
+		`, roomId, userId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "room", roomId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		reqBody, resBody, errSender := safeDeliver(req, notice)
+		sender := fmt.Sprintf("[%s,%s]", reqBody, resBody)
+
+		err = stx.Execute(`INSERT INTO notice_history (notice_room_id, o_sender, b_sended) VALUES ($1, $2, $3);`,
+			roomId, sender, errSender == nil)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if err := prunePush(stx, notice["e_type"], resBody); db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		test := &NoticeTest{Sended: errSender == nil, Sender: json.RawMessage(sender)}
+		if errSender != nil {
+			test.Error = errSender.Error()
+		}
+		return commitJSON(c, stx, fiber.StatusOK, test)
+	})
+}
+
+func HandlerGetSection(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sections, err := querySections(stx, userId, 0)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, sections)
+	})
+}
+
+func HandlerGetSectionByID(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		sections, err := querySections(stx, userId, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if len(sections) == 0 {
+			return throwNotFound(c, stx, "section", sectionId)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, sections[0])
+	})
+}
+
+func HandlerAddSection(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		req := new(RequestSection)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidateSection(req.Name); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidatePolicy(req.Policy); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidateEscalation(req.Escalation); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := checkSectionName(stx, userId, 0, req.Name); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := checkEscalationRooms(stx, userId, req.Escalation); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		row, err := stx.QueryOne(`
+			INSERT INTO notice_section (user_id, s_name, n_uuid, o_policy, o_escalation)
+			VALUES ($1, $2, uuid_generate_v4(), COALESCE($3::jsonb, '{}'), COALESCE($4::jsonb, '{}')) RETURNING id;
+		`, userId, req.Name, policyParam(req.Policy), escalationParam(req.Escalation))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		sections, err := querySections(stx, userId, int(row.ToInt64("id")))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusCreated, sections[0])
+	})
+}
+
+func HandlerUpdateSection(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestSection)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidateSection(req.Name); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidatePolicy(req.Policy); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidateEscalation(req.Escalation); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := checkSectionName(stx, userId, sectionId, req.Name); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := checkEscalationRooms(stx, userId, req.Escalation); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		_, err = stx.QueryOne(`
+			UPDATE notice_section SET s_name = $3, o_policy = COALESCE($4::jsonb, o_policy), o_escalation = COALESCE($5::jsonb, o_escalation)
+			WHERE id = $1 AND user_id = $2 AND t_deleted IS NULL RETURNING id;
+		`, sectionId, userId, req.Name, policyParam(req.Policy), escalationParam(req.Escalation))
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "section", sectionId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		sections, err := querySections(stx, userId, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, sections[0])
+	})
+}
+
+// HandlerDeleteSection soft delete section with its subscribers.
+func HandlerDeleteSection(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		_, err = stx.QueryOne(`
+			UPDATE notice_section SET t_deleted = NOW()
+			WHERE id = $1 AND user_id = $2 AND t_deleted IS NULL RETURNING id;
+		`, sectionId, userId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "section", sectionId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = stx.Execute(`UPDATE notice_subscriber SET t_deleted = NOW() WHERE notice_section_id = $1 AND t_deleted IS NULL;`, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		err = stx.Execute(`UPDATE notice_template SET t_deleted = NOW() WHERE notice_section_id = $1 AND t_deleted IS NULL;`, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, fiber.Map{})
+	})
+}
+
+func HandlerAddSubscriber(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestSubscriber)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidateSubscriber(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		sections, err := querySections(stx, userId, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if len(sections) == 0 {
+			return throwNotFound(c, stx, "section", sectionId)
+		}
+		for _, roomId := range sections[0].Rooms {
+			if roomId == req.Room {
+				return throwBadRequest(c, stx, fmt.Errorf("room %d is already subscribed", req.Room))
+			}
+		}
+
+		rooms, err := queryRooms(stx, userId, int(req.Room))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if req.Room <= 0 || len(rooms) == 0 {
+			return throwBadRequest(c, stx, fmt.Errorf("room %d not found", req.Room))
+		}
+
+		err = stx.Execute(`
+			INSERT INTO notice_subscriber (notice_section_id, notice_room_id, e_severity, o_quiet) VALUES ($1, $2, $3, $4);
+		`, sectionId, req.Room, req.Severity, quietParam(req.Quiet))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		sections, err = querySections(stx, userId, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusCreated, sections[0])
+	})
+}
+
+// HandlerUpdateSubscriber replace minimum severity and quiet window of subscribed room.
+func HandlerUpdateSubscriber(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		roomId, err := c.ParamsInt("roomId")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestSubscriber)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidateSubscriber(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		_, err = stx.QueryOne(`
+			UPDATE notice_subscriber ss SET e_severity = $4, o_quiet = $5
+			FROM notice_section st
+			WHERE st.id = ss.notice_section_id AND ss.notice_section_id = $1 AND ss.notice_room_id = $2
+				AND st.user_id = $3 AND ss.t_deleted IS NULL
+			RETURNING ss.notice_room_id;
+		`, sectionId, roomId, userId, req.Severity, quietParam(req.Quiet))
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "subscriber", roomId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		sections, err := querySections(stx, userId, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, sections[0])
+	})
+}
+
+func HandlerDeleteSubscriber(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		roomId, err := c.ParamsInt("roomId")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		_, err = stx.QueryOne(`
+			UPDATE notice_subscriber ss SET t_deleted = NOW()
+			FROM notice_section st
+			WHERE st.id = ss.notice_section_id AND ss.notice_section_id = $1 AND ss.notice_room_id = $2
+				AND st.user_id = $3 AND ss.t_deleted IS NULL
+			RETURNING ss.notice_room_id;
+		`, sectionId, roomId, userId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "subscriber", roomId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		sections, err := querySections(stx, userId, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, sections[0])
+	})
+}
+
+func HandlerGetTemplate(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		sections, err := querySections(stx, userId, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if len(sections) == 0 {
+			return throwNotFound(c, stx, "section", sectionId)
+		}
+
+		templates, err := queryTemplates(stx, userId, sectionId, "")
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, templates)
+	})
+}
+
+func HandlerAddTemplate(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestTemplate)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidateTemplate(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		sections, err := querySections(stx, userId, sectionId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if len(sections) == 0 {
+			return throwNotFound(c, stx, "section", sectionId)
+		}
+		if err := checkTemplateName(stx, sectionId, "", req.Name); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		err = stx.Execute(`
+			INSERT INTO notice_template (notice_section_id, s_name, s_subject, s_body) VALUES ($1, $2, $3, $4);
+		`, sectionId, req.Name, req.Subject, req.Body)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		templates, err := queryTemplates(stx, userId, sectionId, req.Name)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusCreated, templates[0])
+	})
+}
+
+func HandlerUpdateTemplate(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		name := c.Params("name")
+
+		req := new(RequestTemplate)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidateTemplate(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := checkTemplateName(stx, sectionId, name, req.Name); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		_, err = stx.QueryOne(`
+			UPDATE notice_template tp SET s_name = $4, s_subject = $5, s_body = $6
+			FROM notice_section st
+			WHERE st.id = tp.notice_section_id AND tp.notice_section_id = $1 AND tp.s_name = $2
+				AND st.user_id = $3 AND st.t_deleted IS NULL AND tp.t_deleted IS NULL
+			RETURNING tp.id;
+		`, sectionId, name, userId, req.Name, req.Subject, req.Body)
+		if err == db.ErrNoRows {
+			return throwTemplateNotFound(c, stx, name)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		templates, err := queryTemplates(stx, userId, sectionId, req.Name)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, templates[0])
+	})
+}
+
+func HandlerDeleteTemplate(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		name := c.Params("name")
+
+		_, err = stx.QueryOne(`
+			UPDATE notice_template tp SET t_deleted = NOW()
+			FROM notice_section st
+			WHERE st.id = tp.notice_section_id AND tp.notice_section_id = $1 AND tp.s_name = $2
+				AND st.user_id = $3 AND tp.t_deleted IS NULL
+			RETURNING tp.id;
+		`, sectionId, name, userId)
+		if err == db.ErrNoRows {
+			return throwTemplateNotFound(c, stx, name)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, fiber.Map{})
+	})
+}
+
+// HandlerPreviewTemplate render template with variables in every format without sending it.
+func HandlerPreviewTemplate(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		sectionId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		name := c.Params("name")
+
+		req := new(RequestPreview)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		templates, err := queryTemplates(stx, userId, sectionId, name)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		if len(templates) == 0 {
+			return throwTemplateNotFound(c, stx, name)
+		}
+
+		notice := &RequestNotice{Variables: req.Variables}
+		if err := notice.renderTemplate(&TemplateSource{Subject: templates[0].Subject, Body: templates[0].Body}); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		preview := &NoticePreview{Subject: notice.Subject, Body: map[string]string{}}
+		for key, format := range noticeFormats {
+			body, err := formatMessage(notice, format)
+			if err != nil {
+				return throwBadRequest(c, stx, err)
+			}
+			preview.Body[key] = body
+		}
+		return commitJSON(c, stx, fiber.StatusOK, preview)
+	})
+}
+
+func throwTemplateNotFound(c *fiber.Ctx, stx *db.PGTx, name string) error {
+	stx.Rollback()
+	return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("template '%s' not found", name))
+}
+
+// checkTemplateName name is unique in section, current is name of updated template.
+func checkTemplateName(stx *db.PGTx, sectionId int, current string, name string) error {
+	_, err := stx.QueryOne(`
+		SELECT id FROM notice_template WHERE notice_section_id = $1 AND s_name <> $2 AND s_name = $3 AND t_deleted IS NULL;
+	`, sectionId, current, name)
+	if err == db.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return fmt.Errorf("template '%s' is already exists", name)
+}
+
+func checkSectionName(stx *db.PGTx, userId int64, sectionId int, name string) error {
+	_, err := stx.QueryOne(`
+		SELECT id FROM notice_section WHERE user_id = $1 AND id <> $2 AND s_name = $3 AND t_deleted IS NULL;
+	`, userId, sectionId, name)
+	if err == db.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return fmt.Errorf("section '%s' is already exists", name)
+}
+
+// queryProviders fetch providers of user, providerId 0 is all providers.
+// checkEscalationRooms every room of escalation steps must be room of user.
+func checkEscalationRooms(stx *db.PGTx, userId int64, escalation *NoticeEscalation) error {
+	if escalation == nil {
+		return nil
+	}
+	for _, step := range escalation.Steps {
+		rooms, err := queryRooms(stx, userId, int(step.Room))
+		if err != nil {
+			return err
+		}
+		if len(rooms) == 0 {
+			return fmt.Errorf("room %d not found", step.Room)
+		}
+	}
+	return nil
+}
+
+func queryProviders(stx *db.PGTx, userId int64, providerId int) ([]*NoticeProvider, error) {
+	rows, err := stx.Query(`
+		SELECT id, e_type, o_param, t_created FROM notice_provider
+		WHERE user_id = $1 AND ($2 = 0 OR id = $2) AND NOT b_deleted
+		ORDER BY id;
+	`, userId, providerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := []*NoticeProvider{}
+	for _, row := range record {
+		providers = append(providers, &NoticeProvider{
+			ID:      row.ToInt64("id"),
+			Type:    row["e_type"],
+			Param:   json.RawMessage(redactParam(providerParam(row["e_type"]), row.ToByte("o_param"))),
+			Created: row.ToTime("t_created"),
+		})
+	}
+	return providers, nil
+}
+
+// queryRooms fetch rooms of user, roomId 0 is all rooms.
+func queryRooms(stx *db.PGTx, userId int64, roomId int) ([]*NoticeRoom, error) {
+	rows, err := stx.Query(`
+		SELECT
+			sr.id, sr.notice_provider_id, pv.e_type, sr.o_param, sr.o_policy,
+			CASE WHEN sr.t_mute > NOW() THEN sr.t_mute END t_mute, sr.t_created
+		FROM notice_room sr
+		INNER JOIN notice_provider pv ON pv.id = sr.notice_provider_id
+		WHERE pv.user_id = $1 AND ($2 = 0 OR sr.id = $2) AND NOT sr.b_deleted AND NOT pv.b_deleted
+		ORDER BY sr.id;
+	`, userId, roomId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	rooms := []*NoticeRoom{}
+	for _, row := range record {
+		room := &NoticeRoom{
+			ID:       row.ToInt64("id"),
+			Provider: row.ToInt64("notice_provider_id"),
+			Type:     row["e_type"],
+			Param:    json.RawMessage(redactParam(roomParam(row["e_type"]), row.ToByte("o_param"))),
+			Policy:   parsePolicy(row.ToByte("o_policy")),
+			Created:  row.ToTime("t_created"),
+		}
+		if row["t_mute"] != "" {
+			mute := row.ToTime("t_mute")
+			room.Mute = &mute
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, nil
+}
+
+// querySections fetch sections of user with subscribed rooms, sectionId 0 is all sections.
+func querySections(stx *db.PGTx, userId int64, sectionId int) ([]*NoticeSection, error) {
+	rows, err := stx.Query(`
+		SELECT id, s_name, n_uuid, o_policy, o_escalation, t_created FROM notice_section
+		WHERE user_id = $1 AND ($2 = 0 OR id = $2) AND t_deleted IS NULL
+		ORDER BY id;
+	`, userId, sectionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := []*NoticeSection{}
+	sectionIndex := map[int64]*NoticeSection{}
+	for _, row := range record {
+		section := &NoticeSection{
+			ID:          row.ToInt64("id"),
+			Name:        row["s_name"],
+			UUID:        row["n_uuid"],
+			Rooms:       []int64{},
+			Subscribers: []*NoticeSubscriber{},
+			Policy:      parsePolicy(row.ToByte("o_policy")),
+			Escalation:  parseEscalation(row.ToByte("o_escalation")),
+			Created:     row.ToTime("t_created"),
+		}
+		sections = append(sections, section)
+		sectionIndex[section.ID] = section
+	}
+
+	subRows, err := stx.Query(`
+		SELECT ss.notice_section_id, ss.notice_room_id, ss.e_severity::text, ss.o_quiet
+		FROM notice_subscriber ss
+		INNER JOIN notice_section st ON st.id = ss.notice_section_id
+		WHERE st.user_id = $1 AND ($2 = 0 OR st.id = $2) AND ss.t_deleted IS NULL
+		ORDER BY ss.notice_room_id;
+	`, userId, sectionId)
+	if err != nil {
+		return nil, err
+	}
+	defer subRows.Close()
+
+	subRecord, err := stx.FetchAll(subRows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range subRecord {
+		if section, ok := sectionIndex[row.ToInt64("notice_section_id")]; ok {
+			section.Rooms = append(section.Rooms, row.ToInt64("notice_room_id"))
+			section.Subscribers = append(section.Subscribers, &NoticeSubscriber{
+				Room:     row.ToInt64("notice_room_id"),
+				Severity: row["e_severity"],
+				Quiet:    parseQuiet(row.ToByte("o_quiet")),
+			})
+		}
+	}
+	return sections, nil
+}
+
+// queryTemplates fetch templates of section, name empty is all templates.
+func queryTemplates(stx *db.PGTx, userId int64, sectionId int, name string) ([]*NoticeTemplate, error) {
+	rows, err := stx.Query(`
+		SELECT tp.id, tp.notice_section_id, tp.s_name, tp.s_subject, tp.s_body, tp.t_created
+		FROM notice_template tp
+		INNER JOIN notice_section st ON st.id = tp.notice_section_id
+		WHERE st.user_id = $1 AND st.id = $2 AND ($3 = '' OR tp.s_name = $3)
+			AND st.t_deleted IS NULL AND tp.t_deleted IS NULL
+		ORDER BY tp.s_name;
+	`, userId, sectionId, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []*NoticeTemplate{}
+	for _, row := range record {
+		templates = append(templates, &NoticeTemplate{
+			ID:      row.ToInt64("id"),
+			Section: row.ToInt64("notice_section_id"),
+			Name:    row["s_name"],
+			Subject: row["s_subject"],
+			Body:    row["s_body"],
+			Created: row.ToTime("t_created"),
+		})
+	}
+	return templates, nil
+}
@@ -0,0 +1,70 @@
+package notice
+
+import (
+	"fmt"
+
+	"github.com/touno-io/core/db"
+)
+
+type MSTeamRoom struct {
+	Name    string `json:"name"`
+	Webhook string `json:"webhook" secret:"true"`
+}
+
+// MSTeamRequest is the legacy MessageCard accepted by incoming webhook connector.
+type MSTeamRequest struct {
+	Type    string `json:"@type"`
+	Context string `json:"@context"`
+	Summary string `json:"summary"`
+	Title   string `json:"title,omitempty"`
+	Text    string `json:"text"`
+}
+
+type MSTeamResponse struct {
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+}
+
+// ProviderMSTeam post to incoming webhook url of the room, the url is the whole endpoint so it is never fixed to microsoft host.
+func ProviderMSTeam(req *RequestNotice, notice db.PGRow) (string, string, error) {
+	room := new(MSTeamRoom)
+	if err := unmarshalNotice(notice, &struct{}{}, room); err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+	if room.Webhook == "" {
+		return jsonEmpty, jsonEmpty, fmt.Errorf("webhook is required")
+	}
+
+	summary := req.Subject
+	if summary == "" {
+		summary = req.Message
+	}
+
+	reqSender := &MSTeamRequest{
+		Type:    "MessageCard",
+		Context: "https://schema.org/extensions",
+		Summary: truncate(summary, 80),
+		Title:   req.Subject,
+		Text:    req.Message,
+	}
+	resSender := &MSTeamResponse{}
+
+	res, errSender := newClient("").R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(reqSender).
+		Post(room.Webhook)
+	if res != nil {
+		resSender.Status = res.StatusCode()
+		resSender.Body = res.String()
+	}
+
+	reqBody, resBody, err := senderBody(reqSender, resSender)
+	if err != nil {
+		return reqBody, resBody, err
+	}
+
+	if errSender == nil && res.IsError() {
+		errSender = fmt.Errorf("%s %s", res.Status(), res.String())
+	}
+	return reqBody, resBody, errSender
+}
@@ -0,0 +1,160 @@
+package notice
+
+import (
+	"fmt"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	OutboxPending  = "PENDING"
+	OutboxSent     = "SENT"
+	OutboxDead     = "DEAD"
+	OutboxDigest   = "DIGEST"
+	OutboxDigested = "DIGESTED"
+)
+
+// Enqueue store message with an outbox row for every room subscribed to the section, Worker deliver it later.
+// allow filter rooms by provider type and nil is allow all, no message is stored when no room is matched.
+// Policy of section and room may suppress duplicated message or batch it into digest, subscriber skip message
+// below its severity and hold message which is not critical in quiet hours, muted room skip it. Escalation of section start when
+// the message is at least its severity.
+func Enqueue(stx *db.PGTx, sectionId int64, req *RequestNotice, allow func(eType string) bool) (*ResponseNotice, error) {
+	res := &ResponseNotice{}
+	rows, err := stx.Query(`
+		SELECT
+			ss.notice_room_id, pv.e_type, ss.e_severity::text, ss.o_quiet, COALESCE(sr.t_mute > NOW(), false) b_muted, sr.o_policy room_policy,
+			st.o_policy section_policy, st.o_escalation
+		FROM notice_subscriber ss
+		INNER JOIN notice_section st ON st.id = ss.notice_section_id
+		INNER JOIN notice_room sr ON sr.id = ss.notice_room_id
+		INNER JOIN notice_provider pv ON pv.id = sr.notice_provider_id
+		WHERE ss.notice_section_id = $1 AND ss.t_deleted IS NULL
+			AND NOT sr.b_deleted AND NOT pv.b_deleted
+		ORDER BY ss.notice_room_id
+	`, sectionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	notices := []db.PGRow{}
+	for _, notice := range record {
+		if allow != nil && !allow(notice["e_type"]) {
+			continue
+		}
+		if severityLevel(req.Severity) < severityLevel(notice["e_severity"]) || (notice.ToBoolean("b_muted") && req.Severity != SeverityCritical) {
+			res.Filtered++
+			continue
+		}
+		notices = append(notices, notice)
+	}
+	if len(notices) == 0 {
+		return res, nil
+	}
+
+	now := time.Now()
+	sectionDue, suppressed, err := applyPolicy(stx, fmt.Sprintf("section:%d", sectionId), parsePolicy(notices[0].ToByte("section_policy")), req, now)
+	if err != nil {
+		return nil, err
+	}
+	if suppressed {
+		res.Suppressed = true
+		return res, nil
+	}
+
+	rooms := []int64{}
+	dues := []time.Time{}
+	digests := []bool{}
+	for _, notice := range notices {
+		due, suppressed, err := applyPolicy(stx, "room:"+notice["notice_room_id"], parsePolicy(notice.ToByte("room_policy")), req, now)
+		if err != nil {
+			return nil, err
+		}
+		if suppressed {
+			continue
+		}
+		if sectionDue.After(due) {
+			due = sectionDue
+		}
+		digest := !due.IsZero()
+		if req.Severity != SeverityCritical {
+			if until := parseQuiet(notice.ToByte("o_quiet")).until(now); until.After(due) {
+				due = until
+			}
+		}
+		rooms = append(rooms, notice.ToInt64("notice_room_id"))
+		dues = append(dues, due)
+		digests = append(digests, digest)
+	}
+	if len(rooms) == 0 {
+		res.Suppressed = true
+		return res, nil
+	}
+
+	var ackHash string
+	escalation := parseEscalation(notices[0].ToByte("o_escalation"))
+	if len(escalation.Steps) > 0 && severityLevel(req.Severity) >= severityLevel(escalation.Severity) {
+		var token string
+		if token, ackHash, err = api.RandomToken(ackTokenSize); err != nil {
+			return nil, err
+		}
+		if req.AckURL = ackURL(token); req.AckURL != "" {
+			req.Message = fmt.Sprintf("%s\n\nAcknowledge: %s", req.Message, req.AckURL)
+		}
+	}
+
+	data := make([][]byte, len(req.Attachments))
+	for i, attachment := range req.Attachments {
+		data[i], attachment.Data = attachment.Data, nil
+	}
+
+	request, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(req)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := stx.QueryOne(`INSERT INTO notice_message (notice_section_id, o_request) VALUES ($1, $2) RETURNING id;`, sectionId, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertAttachments(stx, message["id"], req.Attachments, data); err != nil {
+		return nil, err
+	}
+	if ackHash != "" {
+		if err := insertEscalation(stx, message["id"], escalation, ackHash); err != nil {
+			return nil, err
+		}
+		res.Escalation = true
+	}
+
+	for i, roomId := range rooms {
+		switch {
+		case dues[i].IsZero():
+			err = stx.Execute(`INSERT INTO notice_outbox (notice_message_id, notice_room_id) VALUES ($1, $2);`, message["id"], roomId)
+		case digests[i]:
+			err = stx.Execute(`INSERT INTO notice_outbox (notice_message_id, notice_room_id, e_status, t_next) VALUES ($1, $2, 'DIGEST', $3);`,
+				message["id"], roomId, dues[i])
+			res.Digest++
+		default:
+			err = stx.Execute(`INSERT INTO notice_outbox (notice_message_id, notice_room_id, t_next) VALUES ($1, $2, $3);`,
+				message["id"], roomId, dues[i])
+			res.Quiet++
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	res.ID = message["id"]
+	res.Rooms = len(rooms)
+	return res, nil
+}
@@ -0,0 +1,222 @@
+package notice
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	maxPolicyWindow = 24 * 60 * 60
+	maxDedupWindow  = 7 * maxPolicyWindow
+	maxDigestItem   = 50
+	digestLineSize  = 200
+)
+
+// NoticePolicy of section or room, window is in seconds and zero is disabled.
+// Message over rate limit is not dropped, it is batched into digest until the window ends.
+type NoticePolicy struct {
+	RateLimit   int `json:"rate_limit,omitempty"`
+	RateWindow  int `json:"rate_window,omitempty"`
+	DedupWindow int `json:"dedup_window,omitempty"`
+	Digest      int `json:"digest,omitempty"`
+}
+
+func parsePolicy(param []byte) *NoticePolicy {
+	policy := new(NoticePolicy)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(param, policy); err != nil {
+		db.Errorf("Notice::Policy %s", err)
+	}
+	return policy
+}
+
+// policyParam json of policy for o_policy, nil keep the stored policy.
+func policyParam(policy *NoticePolicy) any {
+	if policy == nil {
+		return nil
+	}
+	param, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(policy)
+	if err != nil {
+		return nil
+	}
+	return param
+}
+
+// applyPolicy count message in scope, it return time of digest when message must be batched
+// or suppressed when the same dedup key is seen in the window.
+func applyPolicy(stx *db.PGTx, scope string, policy *NoticePolicy, req *RequestNotice, now time.Time) (time.Time, bool, error) {
+	var due time.Time
+	if policy.DedupWindow > 0 {
+		count, _, err := hitCounter(stx, fmt.Sprintf("dedup:%s:%s", scope, dedupKey(req)), policy.DedupWindow, now)
+		if err != nil || count > 1 {
+			return due, err == nil, err
+		}
+	}
+
+	if policy.RateLimit > 0 && policy.RateWindow > 0 {
+		count, expire, err := hitCounter(stx, "rate:"+scope, policy.RateWindow, now)
+		if err != nil {
+			return due, false, err
+		}
+		if count > int64(policy.RateLimit) {
+			due = expire
+		}
+	}
+
+	if policy.Digest > 0 {
+		_, expire, err := hitCounter(stx, "digest:"+scope, policy.Digest, now)
+		if err != nil {
+			return due, false, err
+		}
+		if expire.After(due) {
+			due = expire
+		}
+	}
+	return due, false, nil
+}
+
+// hitCounter increase counter of fixed window in cache.notice, the window start at the first hit.
+// Row is locked by upsert so every instance see the same count.
+func hitCounter(stx *db.PGTx, key string, window int, now time.Time) (int64, time.Time, error) {
+	row, err := stx.QueryOne(`
+		INSERT INTO "cache"."notice" AS cn (s_key, n_count, t_expire) VALUES ($1, 1, $2)
+		ON CONFLICT (s_key) DO UPDATE SET
+			n_count = CASE WHEN cn.t_expire <= $3 THEN 1 ELSE cn.n_count + 1 END,
+			t_expire = CASE WHEN cn.t_expire <= $3 THEN $2 ELSE cn.t_expire END
+		RETURNING n_count, t_expire;
+	`, key, now.Unix()+int64(window), now.Unix())
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return row.ToInt64("n_count"), time.Unix(row.ToInt64("t_expire"), 0), nil
+}
+
+// dedupKey of request or hash of subject and message.
+func dedupKey(req *RequestNotice) string {
+	key := req.DedupKey
+	if key == "" {
+		key = req.Subject + "\n" + req.Message
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// cleanCounter delete expired counters of cache.notice.
+func cleanCounter(pgx *db.PGClient) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+	if err := stx.Execute(`DELETE FROM "cache"."notice" WHERE t_expire <= $1;`, time.Now().Unix()); db.IsRollback(err, stx) {
+		return err
+	}
+	return stx.Commit()
+}
+
+// flushDigest queue one summary message for each room and section which digest is due,
+// a digest of one message is queued as it is.
+func flushDigest(pgx *db.PGClient) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	rows, err := stx.Query(`
+		SELECT ob.id, ob.notice_room_id, msg.notice_section_id, st.s_name, msg.o_request, msg.t_created
+		FROM notice_outbox ob
+		INNER JOIN notice_message msg ON msg.id = ob.notice_message_id
+		INNER JOIN notice_section st ON st.id = msg.notice_section_id
+		WHERE ob.e_status = 'DIGEST' AND ob.t_next <= NOW()
+		ORDER BY ob.notice_room_id, msg.notice_section_id, msg.t_created
+		FOR UPDATE OF ob SKIP LOCKED
+	`)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+
+	groups := [][]db.PGRow{}
+	for i, row := range record {
+		if i == 0 || row["notice_room_id"] != record[i-1]["notice_room_id"] || row["notice_section_id"] != record[i-1]["notice_section_id"] {
+			groups = append(groups, []db.PGRow{})
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], row)
+	}
+
+	for _, group := range groups {
+		if len(group) == 1 {
+			err = stx.Execute(`UPDATE notice_outbox SET e_status = 'PENDING', t_next = NOW() WHERE id = $1;`, group[0]["id"])
+			if db.IsRollback(err, stx) {
+				return err
+			}
+			continue
+		}
+
+		request, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(digestNotice(group))
+		if db.IsRollback(err, stx) {
+			return err
+		}
+		message, err := stx.QueryOne(`INSERT INTO notice_message (notice_section_id, o_request) VALUES ($1, $2) RETURNING id;`,
+			group[0]["notice_section_id"], request)
+		if db.IsRollback(err, stx) {
+			return err
+		}
+		err = stx.Execute(`INSERT INTO notice_outbox (notice_message_id, notice_room_id) VALUES ($1, $2);`, message["id"], group[0]["notice_room_id"])
+		if db.IsRollback(err, stx) {
+			return err
+		}
+
+		for _, row := range group {
+			err = stx.Execute(`
+				UPDATE notice_outbox SET e_status = 'DIGESTED', notice_digest_id = $2, t_sent = NOW() WHERE id = $1;
+			`, row["id"], message["id"])
+			if db.IsRollback(err, stx) {
+				return err
+			}
+		}
+		db.Debugf("Notice::Digest room %s section %s with %d messages", group[0]["notice_room_id"], group[0]["s_name"], len(group))
+	}
+	return stx.Commit()
+}
+
+// digestNotice summary of batched messages, a line for each message.
+func digestNotice(group []db.PGRow) *RequestNotice {
+	lines := []string{}
+	for i, row := range group {
+		if i == maxDigestItem {
+			lines = append(lines, fmt.Sprintf("… and %d more", len(group)-maxDigestItem))
+			break
+		}
+
+		req := new(RequestNotice)
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_request"), req); err != nil {
+			continue
+		}
+		text := strings.TrimSpace(req.Message)
+		if line, _, ok := strings.Cut(text, "\n"); ok {
+			text = line
+		}
+		if req.Subject != "" {
+			text = fmt.Sprintf("%s: %s", req.Subject, text)
+		}
+		if len(req.Attachments) > 0 {
+			text = fmt.Sprintf("%s (%d attachments)", text, len(req.Attachments))
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s", row.ToTime("t_created").Format("2006-01-02 15:04:05"), truncate(text, digestLineSize)))
+	}
+
+	return &RequestNotice{
+		Subject: fmt.Sprintf("%s digest of %d notices", group[0]["s_name"], len(group)),
+		Message: strings.Join(lines, "\n"),
+	}
+}
@@ -0,0 +1,169 @@
+package notice
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/touno-io/core/db"
+)
+
+// testPGClient connect postgres of PG_* environment and migrate the schema, test is skipped without it.
+func testPGClient(t *testing.T) *db.PGClient {
+	t.Helper()
+	if os.Getenv(db.PGHOST) == "" {
+		t.Skip("postgres is not set, PG_HOST is empty")
+	}
+
+	ctx := context.Background()
+	pgx := &db.PGClient{}
+	pgx.Connect(&ctx, "notice-test")
+	t.Cleanup(func() { pgx.Close() })
+
+	goose.SetTableName("db_version")
+	if err := goose.Up(pgx.DB, "../../db/schema"); err != nil {
+		t.Fatal(err)
+	}
+	return pgx
+}
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *NoticePolicy
+		wantErr bool
+	}{
+		{"not set", nil, false},
+		{"disabled", &NoticePolicy{}, false},
+		{"rate limit", &NoticePolicy{RateLimit: 10, RateWindow: 60}, false},
+		{"every policy", &NoticePolicy{RateLimit: 10, RateWindow: 60, DedupWindow: maxDedupWindow, Digest: maxPolicyWindow}, false},
+		{"rate limit without window", &NoticePolicy{RateLimit: 10}, true},
+		{"rate window without limit", &NoticePolicy{RateWindow: 60}, true},
+		{"negative", &NoticePolicy{Digest: -1}, true},
+		{"rate window is too long", &NoticePolicy{RateLimit: 1, RateWindow: maxPolicyWindow + 1}, true},
+		{"digest is too long", &NoticePolicy{Digest: maxPolicyWindow + 1}, true},
+		{"dedup window is too long", &NoticePolicy{DedupWindow: maxDedupWindow + 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePolicy(tt.policy); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		param string
+		want  NoticePolicy
+	}{
+		{"empty", "{}", NoticePolicy{}},
+		{"policy", `{"rate_limit":5,"rate_window":60,"dedup_window":300,"digest":900}`, NoticePolicy{5, 60, 300, 900}},
+		{"invalid is disabled", "[", NoticePolicy{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePolicy([]byte(tt.param)); *got != tt.want {
+				t.Errorf("parsePolicy() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  *RequestNotice
+		equal bool
+	}{
+		{"same message", &RequestNotice{Subject: "Down", Message: "api"}, &RequestNotice{Subject: "Down", Message: "api"}, true},
+		{"other message", &RequestNotice{Subject: "Down", Message: "api"}, &RequestNotice{Subject: "Down", Message: "web"}, false},
+		{"other subject", &RequestNotice{Subject: "Down", Message: "api"}, &RequestNotice{Subject: "Up", Message: "api"}, false},
+		{"dedup key", &RequestNotice{DedupKey: "api", Message: "1"}, &RequestNotice{DedupKey: "api", Message: "2"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := dedupKey(tt.a), dedupKey(tt.b)
+			if (a == b) != tt.equal || len(a) != 32 {
+				t.Errorf("dedupKey() = %s %s, want equal %v", a, b, tt.equal)
+			}
+		})
+	}
+}
+
+func TestDigestNotice(t *testing.T) {
+	group := []db.PGRow{}
+	for i := 0; i < maxDigestItem+2; i++ {
+		group = append(group, db.PGRow{
+			"s_name":    "monitor",
+			"o_request": fmt.Sprintf(`{"subject":"Down %d","message":"api is down\nstack trace"}`, i),
+			"t_created": "2022-08-14T10:35:52Z",
+		})
+	}
+	group[1]["o_request"] = fmt.Sprintf(`{"message":"%s"}`, strings.Repeat("x", digestLineSize*2))
+
+	req := digestNotice(group)
+	lines := strings.Split(req.Message, "\n")
+	if req.Subject != fmt.Sprintf("monitor digest of %d notices", len(group)) {
+		t.Errorf("digestNotice() subject = %s", req.Subject)
+	}
+	if len(lines) != maxDigestItem+1 || lines[len(lines)-1] != "… and 2 more" {
+		t.Fatalf("digestNotice() = %d lines, want %d with the rest counted", len(lines), maxDigestItem+1)
+	}
+	if lines[0] != "[2022-08-14 10:35:52] Down 0: api is down" {
+		t.Errorf("digestNotice() line = %s, want the first line of message", lines[0])
+	}
+	if len([]rune(strings.TrimPrefix(lines[1], "[2022-08-14 10:35:52] "))) > digestLineSize {
+		t.Errorf("digestNotice() line is not truncated %s", lines[1])
+	}
+}
+
+// TestApplyPolicy need postgres, every case use its own scope so counters do not mix.
+func TestApplyPolicy(t *testing.T) {
+	pgx := testPGClient(t)
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stx.Rollback()
+
+	now := time.Now()
+	tests := []struct {
+		name       string
+		policy     *NoticePolicy
+		digest     []bool
+		suppressed []bool
+	}{
+		{"disabled", &NoticePolicy{}, []bool{false, false, false}, []bool{false, false, false}},
+		{"dedup", &NoticePolicy{DedupWindow: 60}, []bool{false, false}, []bool{false, true}},
+		{"rate limit", &NoticePolicy{RateLimit: 2, RateWindow: 60}, []bool{false, false, true}, []bool{false, false, false}},
+		{"digest", &NoticePolicy{Digest: 60}, []bool{true, true}, []bool{false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope := fmt.Sprintf("test:%s:%d", tt.name, now.UnixNano())
+			for i := range tt.digest {
+				due, suppressed, err := applyPolicy(stx, scope, tt.policy, &RequestNotice{Message: "api is down"}, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if suppressed != tt.suppressed[i] || due.IsZero() == tt.digest[i] {
+					t.Errorf("applyPolicy() message %d = %s %v, want digest %v suppressed %v", i+1, due, suppressed, tt.digest[i], tt.suppressed[i])
+				}
+				if !due.IsZero() && due.Unix() != now.Unix()+60 {
+					t.Errorf("applyPolicy() message %d due %s, want end of window", i+1, due)
+				}
+			}
+		})
+	}
+}
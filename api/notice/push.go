@@ -0,0 +1,549 @@
+package notice
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	jose "github.com/dvsekhvalnov/jose2go"
+	"github.com/gofiber/fiber/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/lib/pq"
+	"github.com/touno-io/core/api"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	pushRecordSize  = 4096
+	pushHeaderSize  = 16 + 4 + 1 + 65
+	pushPayloadSize = pushRecordSize - pushHeaderSize - 16 - 1
+	pushTTL         = 24 * 60 * 60
+	pushAuthSize    = 16
+	vapidExpire     = 12 * time.Hour
+)
+
+// pushSubscriptions column of room subscriptions for ProviderNative, sr is notice_room of the row.
+const pushSubscriptions = `CASE WHEN pv.e_type = 'native' THEN (
+	SELECT COALESCE(json_agg(json_build_object('id', np.id, 'endpoint', np.s_endpoint, 'p256dh', np.s_p256dh, 'auth', np.s_auth)), '[]')
+	FROM notice_push np WHERE np.notice_room_id = sr.id
+) ELSE '[]' END push`
+
+// NativeProvider is VAPID key of web push, public key is applicationServerKey of browser subscription.
+// Private key is generated when provider is created, it is changed only by HandlerRotateVapid.
+type NativeProvider struct {
+	Subject    string `json:"subject"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key" secret:"true"`
+}
+
+type PushSubscription struct {
+	ID       int64  `json:"id"`
+	Endpoint string `json:"endpoint"`
+	P256dh   string `json:"p256dh"`
+	Auth     string `json:"auth"`
+}
+
+// PushPayload is json which service worker of browser receive in push event.
+type PushPayload struct {
+	ID       string `json:"id,omitempty"`
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	Severity string `json:"severity,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+type NativeRequest struct {
+	Payload *PushPayload `json:"payload"`
+	Urgency string       `json:"urgency"`
+	TTL     int          `json:"ttl"`
+}
+
+type NativeResponse struct {
+	Sent    int           `json:"sent"`
+	Results []*PushResult `json:"results"`
+}
+
+// PushResult of a subscription, host of endpoint is recorded because endpoint is a credential.
+type PushResult struct {
+	ID     int64  `json:"id"`
+	Host   string `json:"host"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type RequestPush struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+type NoticePush struct {
+	ID        int64     `json:"id"`
+	Host      string    `json:"host"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+type NoticePushKey struct {
+	PublicKey     string        `json:"public_key"`
+	Subscriptions []*NoticePush `json:"subscriptions"`
+}
+
+// ProviderNative send web push to every subscription of the room, it fail only when no subscription accept it.
+// Subscription which is gone is removed by prunePush with the result.
+func ProviderNative(req *RequestNotice, notice db.PGRow) (string, string, error) {
+	provider := new(NativeProvider)
+	if err := unmarshalNotice(notice, provider, &struct{}{}); err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+	key, err := parseVapidKey(provider.PrivateKey)
+	if err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	subscriptions := []*PushSubscription{}
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(notice.ToByte("push"), &subscriptions); err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	reqSender := &NativeRequest{Payload: pushPayload(req, notice), Urgency: "normal", TTL: pushTTL}
+	if req.Severity == SeverityCritical {
+		reqSender.Urgency = "high"
+	}
+	payload, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(reqSender.Payload)
+	if err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	resSender := &NativeResponse{Results: []*PushResult{}}
+	var errSender error
+	for _, subscription := range subscriptions {
+		result := &PushResult{ID: subscription.ID}
+		if u, err := url.Parse(subscription.Endpoint); err == nil {
+			result.Host = u.Host
+		}
+		result.Status, err = sendPush(provider, key, subscription, payload, reqSender)
+		if err != nil {
+			result.Error = err.Error()
+			errSender = err
+		} else {
+			resSender.Sent++
+		}
+		resSender.Results = append(resSender.Results, result)
+	}
+
+	if len(subscriptions) == 0 {
+		errSender = fmt.Errorf("room has no push subscription")
+	} else if resSender.Sent > 0 {
+		errSender = nil
+	}
+
+	reqBody, resBody, err := senderBody(reqSender, resSender)
+	if err != nil {
+		return reqBody, resBody, err
+	}
+	return reqBody, resBody, errSender
+}
+
+// pushPayload cut body so encrypted payload fit in one record of push service.
+func pushPayload(req *RequestNotice, notice db.PGRow) *PushPayload {
+	payload := &PushPayload{
+		ID:       notice["notice_message_id"],
+		Title:    truncate(req.Subject, digestLineSize),
+		Body:     req.Message,
+		Severity: req.Severity,
+		URL:      req.AckURL,
+	}
+	if payload.Title == "" {
+		payload.Title = notice["section"]
+	}
+	for size := len([]rune(payload.Body)); size > 1; size = size * 3 / 4 {
+		data, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(payload)
+		if err == nil && len(data) <= pushPayloadSize {
+			break
+		}
+		payload.Body = truncate(req.Message, size)
+	}
+	return payload
+}
+
+func sendPush(provider *NativeProvider, key *ecdsa.PrivateKey, subscription *PushSubscription, payload []byte, reqSender *NativeRequest) (int, error) {
+	authorization, err := vapidAuthorization(provider, key, subscription.Endpoint)
+	if err != nil {
+		return 0, err
+	}
+	body, err := encryptPush(payload, subscription)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := newClient("").R().
+		SetHeaders(map[string]string{
+			"Authorization":    authorization,
+			"Content-Encoding": "aes128gcm",
+			"Content-Type":     "application/octet-stream",
+			"TTL":              strconv.Itoa(reqSender.TTL),
+			"Urgency":          reqSender.Urgency,
+		}).
+		SetBody(body).
+		Post(subscription.Endpoint)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode() >= 300 {
+		return res.StatusCode(), fmt.Errorf("%d %s", res.StatusCode(), truncate(res.String(), webhookResponseSize))
+	}
+	return res.StatusCode(), nil
+}
+
+// vapidAuthorization https://www.rfc-editor.org/rfc/rfc8292, audience is origin of push service.
+func vapidAuthorization(provider *NativeProvider, key *ecdsa.PrivateKey, endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(map[string]any{
+		"aud": fmt.Sprintf("%s://%s", u.Scheme, u.Host),
+		"exp": time.Now().Add(vapidExpire).Unix(),
+		"sub": provider.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	token, err := jose.SignBytes(claims, jose.ES256, key, jose.Header("typ", "JWT"))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vapid t=%s, k=%s", token, provider.PublicKey), nil
+}
+
+// encryptPush https://www.rfc-editor.org/rfc/rfc8291 with a new key and salt for every message.
+func encryptPush(payload []byte, subscription *PushSubscription) ([]byte, error) {
+	uaPublic, err := decodeBase64URL(subscription.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decodeBase64URL(subscription.Auth)
+	if err != nil {
+		return nil, err
+	}
+	asPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encryptPushKey(payload, uaPublic, authSecret, asPrivate, salt)
+}
+
+func encryptPushKey(payload []byte, uaPublic []byte, authSecret []byte, asPrivate *ecdsa.PrivateKey, salt []byte) ([]byte, error) {
+	if len(payload) > pushPayloadSize {
+		return nil, fmt.Errorf("push payload must be at most %d bytes", pushPayloadSize)
+	}
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, uaPublic)
+	if x == nil {
+		return nil, fmt.Errorf("p256dh is not a P-256 public key")
+	}
+	asPublic := elliptic.Marshal(curve, asPrivate.X, asPrivate.Y)
+	sx, _ := curve.ScalarMult(x, y, asPrivate.D.Bytes())
+	ecdhSecret := sx.FillBytes(make([]byte, 32))
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, pushHeaderSize)
+	header = append(header, salt...)
+	header = append(header, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(header[len(salt):], pushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	// 0x02 is padding delimiter of the last record.
+	return gcm.Seal(header, nonce, append(append([]byte{}, payload...), 0x02), nil), nil
+}
+
+// hkdf of one block which is enough for key and nonce of push.
+func hkdf(salt []byte, ikm []byte, info []byte, size int) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(ikm)
+	prk := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, prk)
+	mac.Write(info)
+	mac.Write([]byte{1})
+	return mac.Sum(nil)[:size]
+}
+
+// generateVapid set a new P-256 key pair of provider.
+func generateVapid(provider *NativeProvider) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	provider.PrivateKey = base64.RawURLEncoding.EncodeToString(key.D.FillBytes(make([]byte, 32)))
+	provider.PublicKey = base64.RawURLEncoding.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+	return nil
+}
+
+// parseVapidKey private key is 32 bytes scalar in base64url.
+func parseVapidKey(privateKey string) (*ecdsa.PrivateKey, error) {
+	d, err := decodeBase64URL(privateKey)
+	if err != nil || len(d) != 32 {
+		return nil, fmt.Errorf("private_key must be 32 bytes in base64url")
+	}
+	curve := elliptic.P256()
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	if key.D.Sign() == 0 || key.D.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("private_key is not a P-256 key")
+	}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(d)
+	return key, nil
+}
+
+// decodeBase64URL accept base64 of browser with or without padding.
+func decodeBase64URL(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.NewReplacer("+", "-", "/", "_").Replace(s), "=")
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// prunePush remove subscriptions which push service answer 404 or 410 in result of ProviderNative.
+func prunePush(stx *db.PGTx, eType string, resBody string) error {
+	if eType != NATIVE {
+		return nil
+	}
+	resSender := new(NativeResponse)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.UnmarshalFromString(resBody, resSender); err != nil {
+		return nil
+	}
+
+	gone := []int64{}
+	for _, result := range resSender.Results {
+		if result.Status == fiber.StatusNotFound || result.Status == fiber.StatusGone {
+			gone = append(gone, result.ID)
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	db.Debugf("Notice::Push remove %d subscriptions which are gone", len(gone))
+	return stx.Execute(`DELETE FROM notice_push WHERE id = ANY($1);`, pq.Array(gone))
+}
+
+// queryNativeRoom public key of native room which belong to user.
+func queryNativeRoom(stx *db.PGTx, userId int64, roomId int) (*NativeProvider, error) {
+	row, err := stx.QueryOne(`
+		SELECT pv.o_param FROM notice_room sr
+		INNER JOIN notice_provider pv ON pv.id = sr.notice_provider_id
+		WHERE sr.id = $1 AND pv.user_id = $2 AND pv.e_type = 'native' AND NOT sr.b_deleted AND NOT pv.b_deleted;
+	`, roomId, userId)
+	if err != nil {
+		return nil, err
+	}
+	provider := new(NativeProvider)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_param"), provider); err != nil {
+		return nil, err
+	}
+	provider.PrivateKey = ""
+	return provider, nil
+}
+
+func queryPush(stx *db.PGTx, userId int64, roomId int) ([]*NoticePush, error) {
+	rows, err := stx.Query(`
+		SELECT id, s_endpoint, COALESCE(s_user_agent, '') s_user_agent, t_created FROM notice_push
+		WHERE notice_room_id = $1 AND user_id = $2
+		ORDER BY id;
+	`, roomId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []*NoticePush{}
+	for _, row := range record {
+		push := &NoticePush{ID: row.ToInt64("id"), UserAgent: row["s_user_agent"], Created: row.ToTime("t_created")}
+		if u, err := url.Parse(row["s_endpoint"]); err == nil {
+			push.Host = u.Host
+		}
+		subscriptions = append(subscriptions, push)
+	}
+	return subscriptions, nil
+}
+
+// HandlerGetPush public key for pushManager.subscribe and subscriptions of user in the room.
+func HandlerGetPush(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		roomId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		provider, err := queryNativeRoom(stx, userId, roomId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "native room", roomId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		subscriptions, err := queryPush(stx, userId, roomId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, &NoticePushKey{PublicKey: provider.PublicKey, Subscriptions: subscriptions})
+	})
+}
+
+// HandlerAddPush register PushSubscription.toJSON() of browser, the same endpoint replace its keys.
+func HandlerAddPush(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		roomId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestPush)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+		if err := ValidatePush(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		provider, err := queryNativeRoom(stx, userId, roomId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "native room", roomId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = stx.Execute(`
+			INSERT INTO notice_push (user_id, notice_room_id, s_endpoint, s_p256dh, s_auth, s_user_agent)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (notice_room_id, s_endpoint) DO UPDATE SET
+				user_id = EXCLUDED.user_id, s_p256dh = EXCLUDED.s_p256dh, s_auth = EXCLUDED.s_auth, s_user_agent = EXCLUDED.s_user_agent;
+		`, userId, roomId, req.Endpoint, req.Keys.P256dh, req.Keys.Auth, truncate(c.Get(fiber.HeaderUserAgent), 255))
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		subscriptions, err := queryPush(stx, userId, roomId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusCreated, &NoticePushKey{PublicKey: provider.PublicKey, Subscriptions: subscriptions})
+	})
+}
+
+// HandlerDeletePush unregister endpoint of browser.
+func HandlerDeletePush(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		roomId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		req := new(RequestPush)
+		if err := c.BodyParser(req); err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		_, err = stx.QueryOne(`
+			DELETE FROM notice_push WHERE notice_room_id = $1 AND user_id = $2 AND s_endpoint = $3 RETURNING id;
+		`, roomId, userId, req.Endpoint)
+		if err == db.ErrNoRows {
+			stx.Rollback()
+			return api.ErrorHandlerThrow(c, fiber.StatusNotFound, fmt.Errorf("push subscription not found"))
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, fiber.Map{})
+	})
+}
+
+// HandlerRotateVapid generate a new key of native provider, subscriptions of the old key are removed
+// so browser must subscribe again with the new public key.
+func HandlerRotateVapid(pgx *db.PGClient) func(c *fiber.Ctx) error {
+	return noticeHandler(pgx, func(c *fiber.Ctx, stx *db.PGTx, userId int64) error {
+		providerId, err := c.ParamsInt("id")
+		if err != nil {
+			return throwBadRequest(c, stx, err)
+		}
+
+		row, err := stx.QueryOne(`
+			SELECT o_param FROM notice_provider WHERE id = $1 AND user_id = $2 AND e_type = 'native' AND NOT b_deleted;
+		`, providerId, userId)
+		if err == db.ErrNoRows {
+			return throwNotFound(c, stx, "native provider", providerId)
+		} else if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		provider := new(NativeProvider)
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(row.ToByte("o_param"), provider); err != nil {
+			stx.Rollback()
+			return api.ThrowInternalServerError(c, err)
+		}
+		if err := generateVapid(provider); err != nil {
+			stx.Rollback()
+			return api.ThrowInternalServerError(c, err)
+		}
+		if err := sealSecret(provider); err != nil {
+			stx.Rollback()
+			return api.ThrowInternalServerError(c, err)
+		}
+		param, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(provider)
+		if err != nil {
+			stx.Rollback()
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		err = stx.Execute(`UPDATE notice_provider SET o_param = $2 WHERE id = $1;`, providerId, param)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		err = stx.Execute(`
+			DELETE FROM notice_push WHERE notice_room_id IN (SELECT id FROM notice_room WHERE notice_provider_id = $1);
+		`, providerId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+
+		providers, err := queryProviders(stx, userId, providerId)
+		if db.IsRollback(err, stx) {
+			return api.ThrowInternalServerError(c, err)
+		}
+		return commitJSON(c, stx, fiber.StatusOK, providers[0])
+	})
+}
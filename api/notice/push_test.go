@@ -0,0 +1,325 @@
+package notice
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jose "github.com/dvsekhvalnov/jose2go"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/db"
+)
+
+// rfc8291 is the example of https://www.rfc-editor.org/rfc/rfc8291#appendix-A
+var rfc8291 = struct {
+	plaintext, asPrivate, asPublic, uaPrivate, uaPublic, salt, auth, body string
+}{
+	plaintext: "V2hlbiBJIGdyb3cgdXAsIEkgd2FudCB0byBiZSBhIHdhdGVybWVsb24",
+	asPrivate: "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw",
+	asPublic:  "BP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A8",
+	uaPrivate: "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94",
+	uaPublic:  "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+	salt:      "DGv6ra1nlYgDCS1FRnbzlw",
+	auth:      "BTBZMqHH6r4Tts7J_aSIgg",
+	body:      "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN",
+}
+
+func mustBase64URL(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := decodeBase64URL(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// decryptPush is what user agent does with a aes128gcm body of one record.
+func decryptPush(t *testing.T, body []byte, uaPrivate *ecdsa.PrivateKey, authSecret []byte) []byte {
+	t.Helper()
+	if len(body) < pushHeaderSize {
+		t.Fatalf("body of %d bytes is shorter than header", len(body))
+	}
+	salt, rs, idlen := body[:16], binary.BigEndian.Uint32(body[16:20]), int(body[20])
+	if rs != pushRecordSize || idlen != 65 {
+		t.Fatalf("header rs=%d idlen=%d, want %d 65", rs, idlen, pushRecordSize)
+	}
+	asPublic := body[21 : 21+idlen]
+
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, asPublic)
+	sx, _ := curve.ScalarMult(x, y, uaPrivate.D.Bytes())
+	uaPublic := elliptic.Marshal(curve, uaPrivate.X, uaPrivate.Y)
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm := hkdf(authSecret, sx.FillBytes(make([]byte, 32)), keyInfo, 32)
+	block, _ := aes.NewCipher(hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16))
+	gcm, _ := cipher.NewGCM(block)
+
+	plain, err := gcm.Open(nil, hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12), body[21+idlen:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) == 0 || plain[len(plain)-1] != 0x02 {
+		t.Fatalf("record %x does not end with padding delimiter", plain)
+	}
+	return plain[:len(plain)-1]
+}
+
+func newSubscription(t *testing.T, endpoint string) (*PushSubscription, *ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	uaPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, pushAuthSize)
+	rand.Read(auth)
+	return &PushSubscription{
+		ID:       1,
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(elliptic.Marshal(elliptic.P256(), uaPrivate.X, uaPrivate.Y)),
+		Auth:     base64.RawURLEncoding.EncodeToString(auth),
+	}, uaPrivate, auth
+}
+
+func TestEncryptPushKey(t *testing.T) {
+	asPrivate, err := parseVapidKey(rfc8291.asPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(elliptic.Marshal(asPrivate.Curve, asPrivate.X, asPrivate.Y)); got != rfc8291.asPublic {
+		t.Fatalf("public key = %s, want %s", got, rfc8291.asPublic)
+	}
+
+	plaintext := mustBase64URL(t, rfc8291.plaintext)
+	got, err := encryptPushKey(plaintext, mustBase64URL(t, rfc8291.uaPublic), mustBase64URL(t, rfc8291.auth), asPrivate, mustBase64URL(t, rfc8291.salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := base64.RawURLEncoding.EncodeToString(got); body != rfc8291.body {
+		t.Fatalf("encryptPushKey() = %s, want %s", body, rfc8291.body)
+	}
+
+	uaPrivate, err := parseVapidKey(rfc8291.uaPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain := decryptPush(t, got, uaPrivate, mustBase64URL(t, rfc8291.auth)); !bytes.Equal(plain, plaintext) {
+		t.Errorf("decrypt = %s, want %s", plain, plaintext)
+	}
+}
+
+func TestEncryptPush(t *testing.T) {
+	subscription, uaPrivate, auth := newSubscription(t, "https://fcm.googleapis.com/fcm/send/token")
+
+	tests := []struct {
+		name    string
+		payload []byte
+		wantErr bool
+	}{
+		{"empty", []byte{}, false},
+		{"json", []byte(`{"title":"Down","body":"api is down"}`), false},
+		{"full record", bytes.Repeat([]byte("a"), pushPayloadSize), false},
+		{"larger than record", bytes.Repeat([]byte("a"), pushPayloadSize+1), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := encryptPush(tt.payload, subscription)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encryptPush() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(body) > pushRecordSize {
+				t.Errorf("encryptPush() = %d bytes, record size is %d", len(body), pushRecordSize)
+			}
+			if plain := decryptPush(t, body, uaPrivate, auth); !bytes.Equal(plain, tt.payload) {
+				t.Errorf("decrypt = %s, want %s", plain, tt.payload)
+			}
+		})
+	}
+
+	other, _ := encryptPush([]byte("a"), subscription)
+	again, _ := encryptPush([]byte("a"), subscription)
+	if bytes.Equal(other[:16], again[:16]) || bytes.Equal(other[21:86], again[21:86]) {
+		t.Error("encryptPush() use the same salt or key")
+	}
+}
+
+func TestEncryptPushError(t *testing.T) {
+	subscription, _, _ := newSubscription(t, "https://fcm.googleapis.com/fcm/send/token")
+
+	tests := []struct {
+		name   string
+		p256dh string
+		auth   string
+	}{
+		{"p256dh is not base64", "not base64!", subscription.Auth},
+		{"p256dh is not a key", base64.RawURLEncoding.EncodeToString(make([]byte, 65)), subscription.Auth},
+		{"auth is not base64", subscription.P256dh, "not base64!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := encryptPush([]byte("a"), &PushSubscription{P256dh: tt.p256dh, Auth: tt.auth})
+			if err == nil {
+				t.Error("encryptPush() has no error")
+			}
+		})
+	}
+}
+
+func TestParseVapidKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"rfc8291", rfc8291.asPrivate, false},
+		{"padded base64", base64.StdEncoding.EncodeToString(mustBase64URL(t, rfc8291.asPrivate)), false},
+		{"empty", "", true},
+		{"short", base64.RawURLEncoding.EncodeToString(make([]byte, 16)), true},
+		{"zero", base64.RawURLEncoding.EncodeToString(make([]byte, 32)), true},
+		{"not on curve order", base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{0xff}, 32)), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseVapidKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseVapidKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !key.Curve.IsOnCurve(key.X, key.Y) {
+				t.Errorf("parseVapidKey() public key is not on curve")
+			}
+		})
+	}
+}
+
+func TestGenerateVapid(t *testing.T) {
+	provider := new(NativeProvider)
+	if err := generateVapid(provider); err != nil {
+		t.Fatal(err)
+	}
+	key, err := parseVapidKey(provider.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public := base64.RawURLEncoding.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y)); public != provider.PublicKey {
+		t.Errorf("public_key = %s, want %s of private_key", provider.PublicKey, public)
+	}
+}
+
+func TestVapidAuthorization(t *testing.T) {
+	provider := &NativeProvider{Subject: "mailto:admin@touno.io"}
+	if err := generateVapid(provider); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := parseVapidKey(provider.PrivateKey)
+
+	authorization, err := vapidAuthorization(provider, key, "https://fcm.googleapis.com/fcm/send/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, ok := strings.Cut(strings.TrimPrefix(authorization, "vapid t="), ", k=")
+	if !ok || !strings.HasSuffix(authorization, ", k="+provider.PublicKey) {
+		t.Fatalf("vapidAuthorization() = %s", authorization)
+	}
+
+	payload, _, err := jose.Decode(token, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]any{}
+	jsoniter.ConfigCompatibleWithStandardLibrary.UnmarshalFromString(payload, &claims)
+	if claims["aud"] != "https://fcm.googleapis.com" || claims["sub"] != provider.Subject {
+		t.Errorf("claims = %v, want aud of endpoint origin", claims)
+	}
+}
+
+func TestPushPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *RequestNotice
+		title   string
+		message string
+	}{
+		{"section is title", &RequestNotice{Message: "api is down"}, "monitor", "api is down"},
+		{"subject", &RequestNotice{Subject: "Down", Message: "api is down"}, "Down", "api is down"},
+		{"body is cut", &RequestNotice{Subject: "Down", Message: strings.Repeat("ระบบล่ม ", 2000)}, "Down", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := pushPayload(tt.req, db.PGRow{"section": "monitor"})
+			data, _ := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(payload)
+			if len(data) > pushPayloadSize {
+				t.Errorf("pushPayload() = %d bytes, want at most %d", len(data), pushPayloadSize)
+			}
+			if payload.Title != tt.title || (tt.message != "" && payload.Body != tt.message) {
+				t.Errorf("pushPayload() = %s %s, want %s %s", payload.Title, payload.Body, tt.title, tt.message)
+			}
+		})
+	}
+}
+
+func TestProviderNative(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	subscription, uaPrivate, auth := newSubscription(t, server.URL+"/push/token")
+	gone, _, _ := newSubscription(t, server.URL+"/gone")
+	gone.ID = 2
+
+	provider := &NativeProvider{Subject: "mailto:admin@touno.io"}
+	if err := generateVapid(provider); err != nil {
+		t.Fatal(err)
+	}
+	param, _ := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(provider)
+	push, _ := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString([]*PushSubscription{subscription, gone})
+	notice := db.PGRow{"provider": param, "room": "{}", "section": "monitor", "push": push}
+
+	reqBody, resBody, err := ProviderNative(&RequestNotice{Subject: "Down", Message: "api is down", Severity: SeverityCritical}, notice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("Content-Encoding") != "aes128gcm" || header.Get("Urgency") != "high" || !strings.HasPrefix(header.Get("Authorization"), "vapid t=") {
+		t.Errorf("headers %v are not of web push", header)
+	}
+
+	payload := new(PushPayload)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(decryptPush(t, body, uaPrivate, auth), payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Title != "Down" || payload.Body != "api is down" || payload.Severity != SeverityCritical {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	if strings.Contains(reqBody+resBody, "/push/token") || strings.Contains(reqBody+resBody, subscription.P256dh) {
+		t.Errorf("history %s %s keep endpoint or key of subscription", reqBody, resBody)
+	}
+	if !strings.Contains(resBody, `"sent":1`) || !strings.Contains(resBody, `"status":410`) {
+		t.Errorf("history %s does not keep result of subscriptions", resBody)
+	}
+}
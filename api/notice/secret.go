@@ -0,0 +1,330 @@
+package notice
+
+import (
+	"reflect"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api/secret"
+	"github.com/touno-io/core/db"
+)
+
+// secretMask replace every secret in API response and history, client send it back to keep the stored secret.
+const secretMask = "xxxxx"
+
+// jsonUnescapedHTML is JSON of provider which does not escape HTML, such as json.Encoder with SetEscapeHTML(false).
+var jsonUnescapedHTML = jsoniter.Config{EscapeHTML: false}.Froze()
+
+// providerParam typed o_param of notice_provider, nil when type has no param.
+func providerParam(eType string) any {
+	switch eType {
+	case TELEGRAM:
+		return new(TelegramProvider)
+	case SLACK:
+		return new(SlackProvider)
+	case LINE:
+		return new(LineProvider)
+	case WORKPLACE:
+		return new(WorkplaceProvider)
+	case EMAIL:
+		return new(EmailProvider)
+	case WEBHOOK:
+		return new(WebhookProvider)
+	case NATIVE:
+		return new(NativeProvider)
+	default:
+		return nil
+	}
+}
+
+// roomParam typed o_param of notice_room, nil when room has no secret.
+func roomParam(eType string) any {
+	switch eType {
+	case MSTEAM:
+		return new(MSTeamRoom)
+	case LINENOTIFY:
+		return new(LineNotifyRoom)
+	default:
+		return nil
+	}
+}
+
+// walkSecret replace every string field tagged `secret:"true"`, map of string is replaced by value.
+func walkSecret(value any, fn func(s string) (string, error)) error {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	v = v.Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("secret") != "true" {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			s, err := fn(field.String())
+			if err != nil {
+				return err
+			}
+			field.SetString(s)
+		case reflect.Map:
+			if field.Type().Elem().Kind() != reflect.String {
+				continue
+			}
+			for _, key := range field.MapKeys() {
+				s, err := fn(field.MapIndex(key).String())
+				if err != nil {
+					return err
+				}
+				field.SetMapIndex(key, reflect.ValueOf(s))
+			}
+		}
+	}
+	return nil
+}
+
+// sealSecret encrypt secret fields before it is stored.
+func sealSecret(value any) error {
+	return walkSecret(value, func(s string) (string, error) {
+		if s == "" || secret.IsSealed(s) {
+			return s, nil
+		}
+		return secret.Seal([]byte(s))
+	})
+}
+
+// openSecret decrypt secret fields, it must be called only inside provider.
+func openSecret(value any) error {
+	return walkSecret(value, func(s string) (string, error) {
+		plain, err := secret.Open(s)
+		return string(plain), err
+	})
+}
+
+func redactSecret(value any) {
+	_ = walkSecret(value, func(s string) (string, error) {
+		if s == "" {
+			return s, nil
+		}
+		return secretMask, nil
+	})
+}
+
+// keepSecret copy decrypted secret of previous param to fields which client send back as secretMask.
+func keepSecret(value any, previous any) error {
+	if previous == nil {
+		return nil
+	}
+	if err := openSecret(previous); err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(value).Elem()
+	p := reflect.ValueOf(previous).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("secret") != "true" {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			if field.String() == secretMask {
+				field.SetString(p.Field(i).String())
+			}
+		case reflect.Map:
+			for _, key := range field.MapKeys() {
+				old := p.Field(i).MapIndex(key)
+				if field.MapIndex(key).String() == secretMask && old.IsValid() {
+					field.SetMapIndex(key, old)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// secretValues decrypted secrets of provider and room for scrubbing provider error.
+func secretValues(notice db.PGRow) []string {
+	values := []string{}
+	collect := func(value any, param []byte) {
+		if value == nil || jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(param, value) != nil {
+			return
+		}
+		_ = walkSecret(value, func(s string) (string, error) {
+			if plain, err := secret.Open(s); err == nil && len(plain) > 3 {
+				values = append(values, string(plain))
+			}
+			return s, nil
+		})
+	}
+	collect(providerParam(notice["e_type"]), notice.ToByte("provider"))
+	collect(roomParam(notice["e_type"]), notice.ToByte("room"))
+	return values
+}
+
+// scrubSecret replace secrets in text, request and response are JSON so escaped form of secret is replaced too.
+func scrubSecret(text string, values []string) string {
+	for _, value := range values {
+		text = strings.ReplaceAll(text, value, secretMask)
+		for _, config := range []jsoniter.API{jsoniter.ConfigCompatibleWithStandardLibrary, jsonUnescapedHTML} {
+			escaped, err := config.MarshalToString(value)
+			if err != nil {
+				continue
+			}
+			text = strings.ReplaceAll(text, escaped[1:len(escaped)-1], secretMask)
+		}
+	}
+	return text
+}
+
+// redactParam o_param for API response.
+func redactParam(value any, param []byte) []byte {
+	if value == nil {
+		return param
+	}
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	if err := json.Unmarshal(param, value); err != nil {
+		return []byte(jsonEmpty)
+	}
+	redactSecret(value)
+
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return []byte(jsonEmpty)
+	}
+	return redacted
+}
+
+// secretKeys json name of fields tagged `secret:"true"` of typed param.
+func secretKeys(value any) []string {
+	t := reflect.TypeOf(value)
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	t = t.Elem()
+
+	keys := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("secret") != "true" {
+			continue
+		}
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// rewrapParam re-wrap secret keys of param in place, key which typed param does not know is kept as it is.
+func rewrapParam(param map[string]any, keys []string) (bool, error) {
+	changed := false
+	rewrap := func(value any) (any, error) {
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		sealed, ok, err := secret.Rewrap(s)
+		changed = changed || ok
+		return sealed, err
+	}
+
+	for _, key := range keys {
+		var err error
+		switch value := param[key].(type) {
+		case string:
+			param[key], err = rewrap(value)
+		case map[string]any:
+			for k, v := range value {
+				if value[k], err = rewrap(v); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return changed, nil
+}
+
+// RotateSecrets seal plain text secrets and re-wrap secrets of old key with the active key of SECRET_KEYS.
+func RotateSecrets(pgx *db.PGClient) error {
+	stx, err := pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	tables := []struct {
+		Query  string
+		Update string
+		Param  func(eType string) any
+	}{
+		{
+			`SELECT id, e_type, o_param FROM notice_provider WHERE NOT b_deleted`,
+			`UPDATE notice_provider SET o_param = $2 WHERE id = $1;`,
+			providerParam,
+		},
+		{
+			`SELECT sr.id, pv.e_type, sr.o_param FROM notice_room sr INNER JOIN notice_provider pv ON pv.id = sr.notice_provider_id WHERE NOT sr.b_deleted`,
+			`UPDATE notice_room SET o_param = $2 WHERE id = $1;`,
+			roomParam,
+		},
+	}
+
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	rotated := 0
+	for _, table := range tables {
+		rows, err := stx.Query(table.Query)
+		if db.IsRollback(err, stx) {
+			return err
+		}
+		record, err := stx.FetchAll(rows)
+		rows.Close()
+		if db.IsRollback(err, stx) {
+			return err
+		}
+
+		for _, row := range record {
+			keys := secretKeys(table.Param(row["e_type"]))
+			if len(keys) == 0 {
+				continue
+			}
+			value := map[string]any{}
+			if err := json.Unmarshal(row.ToByte("o_param"), &value); err != nil {
+				db.Errorf("Notice::RotateSecrets %s %s %s", row["e_type"], row["id"], err)
+				continue
+			}
+
+			changed, err := rewrapParam(value, keys)
+			if db.IsRollback(err, stx) {
+				return err
+			}
+			if !changed {
+				continue
+			}
+
+			param, err := json.MarshalToString(value)
+			if db.IsRollback(err, stx) {
+				return err
+			}
+			if err := stx.Execute(table.Update, row["id"], param); db.IsRollback(err, stx) {
+				return err
+			}
+			rotated++
+		}
+	}
+
+	if err := stx.Commit(); err != nil {
+		return err
+	}
+	if rotated > 0 {
+		db.Infof("Notice::RotateSecrets %d params are sealed with active key", rotated)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package notice
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/api/secret"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv(secret.SECRET_KEYS, "test:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	os.Exit(m.Run())
+}
+
+func TestScrubSecret(t *testing.T) {
+	values := []string{`pa"ss<word>&`, "token"}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", `error pa"ss<word>& token`, "error xxxxx xxxxx"},
+		{"json escaped", `{"password":"pa\"ss\u003cword\u003e\u0026"}`, `{"password":"xxxxx"}`},
+		{"json escaped without html", `{"password":"pa\"ss<word>&"}`, `{"password":"xxxxx"}`},
+		{"no secret", `{"ok":true}`, `{"ok":true}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scrubSecret(tt.text, values); got != tt.want {
+				t.Errorf("scrubSecret() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  []string
+	}{
+		{"telegram", new(TelegramProvider), []string{"token", "webhook_secret"}},
+		{"webhook", new(WebhookProvider), []string{"headers", "secret"}},
+		{"no secret", new(struct{ Name string }), []string{}},
+		{"nil", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := secretKeys(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("secretKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewrapParam(t *testing.T) {
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	param := map[string]any{}
+	err := json.UnmarshalFromString(`{"url":"https://touno.io","secret":"s3cret","headers":{"Authorization":"Bearer token"},"added":{"key":"kept"}}`, &param)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := rewrapParam(param, secretKeys(new(WebhookProvider)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("rewrapParam() plain text secret is not changed")
+	}
+
+	headers := param["headers"].(map[string]any)
+	for _, value := range []any{param["secret"], headers["Authorization"]} {
+		if !secret.IsSealed(value.(string)) {
+			t.Errorf("rewrapParam() %v is not sealed", value)
+		}
+	}
+	if param["url"] != "https://touno.io" || !reflect.DeepEqual(param["added"], map[string]any{"key": "kept"}) {
+		t.Errorf("rewrapParam() field which is not secret is changed %v", param)
+	}
+
+	changed, err = rewrapParam(param, secretKeys(new(WebhookProvider)))
+	if err != nil || changed {
+		t.Errorf("rewrapParam() sealed param = %v %v, want unchanged", changed, err)
+	}
+}
+
+func TestSealSecret(t *testing.T) {
+	provider := &TelegramProvider{Token: "token"}
+	if err := sealSecret(provider); err != nil {
+		t.Fatal(err)
+	}
+	if !secret.IsSealed(provider.Token) {
+		t.Fatalf("sealSecret() token %s is not sealed", provider.Token)
+	}
+	if err := openSecret(provider); err != nil || provider.Token != "token" {
+		t.Errorf("openSecret() = %s %v, want token", provider.Token, err)
+	}
+}
+
+func TestRedactParam(t *testing.T) {
+	sealed, err := secret.Seal([]byte("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := string(redactParam(new(TelegramProvider), []byte(`{"token":"`+sealed+`","webhook_secret":""}`)))
+	if strings.Contains(got, sealed) || !strings.Contains(got, secretMask) {
+		t.Errorf("redactParam() = %s, secret is not masked", got)
+	}
+}
@@ -0,0 +1,119 @@
+package notice
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/touno-io/core/db"
+)
+
+type SlackProvider struct {
+	Token string `json:"token" secret:"true"`
+}
+type SlackRoom struct {
+	Name    string `json:"name"`
+	Channel string `json:"channel"`
+}
+
+type SlackRequest struct {
+	Channel string       `json:"channel"`
+	Text    string       `json:"text"`
+	Blocks  []SlackBlock `json:"blocks,omitempty"`
+}
+
+// SlackBlock https://api.slack.com/reference/block-kit/blocks
+type SlackBlock struct {
+	Type string     `json:"type"`
+	Text *SlackText `json:"text,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type SlackResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	TS      string `json:"ts,omitempty"`
+}
+
+var slackAPI string = "https://slack.com"
+
+const (
+	slackHeaderSize  = 150
+	slackSectionSize = 3000
+)
+
+func ProviderSlack(req *RequestNotice, notice db.PGRow) (string, string, error) {
+	provider := new(SlackProvider)
+	room := new(SlackRoom)
+	if err := unmarshalNotice(notice, provider, room); err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	text, err := formatMessage(req, formatSlack)
+	if err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	// text is a fallback of notification, blocks is shown in channel.
+	reqSender := &SlackRequest{Channel: room.Channel, Text: formatSlack.escape(noticeText(req)), Blocks: []SlackBlock{}}
+	if req.Subject != "" {
+		reqSender.Blocks = append(reqSender.Blocks, SlackBlock{
+			Type: "header",
+			Text: &SlackText{Type: "plain_text", Text: truncate(req.Subject, slackHeaderSize)},
+		})
+	}
+	for _, chunk := range splitLines(text, slackSectionSize) {
+		reqSender.Blocks = append(reqSender.Blocks, SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: chunk}})
+	}
+
+	resSender := &SlackResponse{}
+
+	_, errSender := newClient(slackAPI).R().
+		SetAuthToken(provider.Token).
+		SetHeader("Content-Type", "application/json; charset=utf-8").
+		SetBody(reqSender).SetResult(resSender).SetError(resSender).
+		Post("/api/chat.postMessage")
+
+	reqBody, resBody, err := senderBody(reqSender, resSender)
+	if err != nil {
+		return reqBody, resBody, err
+	}
+
+	if errSender == nil && !resSender.OK {
+		errSender = fmt.Errorf("%s", resSender.Error)
+	}
+	return reqBody, resBody, errSender
+}
+
+// splitLines split text at line break into chunks of at most size characters.
+func splitLines(text string, size int) []string {
+	chunks := []string{}
+	chunk := ""
+	for _, line := range strings.Split(text, "\n") {
+		line = truncate(line, size)
+		if chunk != "" && len([]rune(chunk))+1+len([]rune(line)) > size {
+			chunks = append(chunks, chunk)
+			chunk = ""
+		}
+		if chunk != "" {
+			chunk += "\n"
+		}
+		chunk += line
+	}
+	if strings.TrimSpace(chunk) != "" {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func truncate(text string, size int) string {
+	runes := []rune(text)
+	if len(runes) <= size {
+		return text
+	}
+	return string(runes[:size-1]) + "…"
+}
@@ -1,16 +1,18 @@
 package notice
 
 import (
-	"regexp"
+	"bytes"
+	"fmt"
+	"strconv"
 
-	"github.com/go-resty/resty/v2"
-	"github.com/gofiber/fiber/v2"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/touno-io/core/db"
 )
 
+// TelegramProvider webhook secret enable HandlerTelegramWebhook, it is secret_token of setWebhook.
 type TelegramProvider struct {
-	Token string `json:"token"`
+	Token         string `json:"token" secret:"true"`
+	WebhookSecret string `json:"webhook_secret,omitempty" secret:"true"`
 }
 type TelegramRoom struct {
 	Mode   string `json:"mode"`
@@ -30,51 +32,108 @@ type TelegramResponse struct {
 	Result      any    `json:"result"`
 }
 
-const telegramAPI string = "https://api.telegram.org"
+var telegramAPI string = "https://api.telegram.org"
+
 const jsonEmpty string = "{}"
 
-func ProviderTelegram(c *fiber.Ctx, req *RequestNotice, notice db.PGRow) (string, string, error) {
+func ProviderTelegram(req *RequestNotice, notice db.PGRow) (string, string, error) {
 	provider := new(TelegramProvider)
 	room := new(TelegramRoom)
 	json := jsoniter.ConfigCompatibleWithStandardLibrary
 
-	if err := json.Unmarshal(notice.ToByte("provider"), provider); err != nil {
+	if err := unmarshalNotice(notice, provider, room); err != nil {
 		return jsonEmpty, jsonEmpty, err
 	}
-	if err := json.Unmarshal(notice.ToByte("room"), room); err != nil {
+
+	format := telegramFormat(room.Mode)
+	text, err := formatMessage(req, format)
+	if err != nil {
 		return jsonEmpty, jsonEmpty, err
 	}
+	if req.Subject != "" {
+		text = fmt.Sprintf("%s\n%s", format.bold(format.escape(req.Subject)), text)
+	}
+	if req.AckURL != "" {
+		text += format.escape(fmt.Sprintf("\n/ack %s", shortID(notice["notice_message_id"])))
+	}
 
-	client := resty.New()
-	client.JSONMarshal = json.Marshal
-	client.JSONUnmarshal = json.Unmarshal
-
-	var fixText = regexp.MustCompile(`([-.])`)
-	reqSender := &TelegramRequest{Mode: room.Mode, Text: fixText.ReplaceAllString(req.Message, `\$1`)}
+	reqSender := &TelegramRequest{Mode: room.Mode, Text: text}
 	resSender := &TelegramResponse{}
 
-	_, err := client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(reqSender).SetResult(resSender).
-		SetPathParams(map[string]string{
-			"uri":     telegramAPI,
-			"token":   provider.Token,
-			"chat_id": string(rune(room.ChatId)),
-		}).
-		Post("{uri}/bot{token}/sendMessage?chat_id={chat_id}")
-
-	var (
-		reqBody []byte
-		resBody []byte
-	)
-
-	if reqBody, err = json.Marshal(reqSender); err != nil {
+	// message of attachments only is not sent, telegram reject empty text.
+	var errSender error
+	if text != "" || len(req.Attachments) == 0 {
+		_, errSender = newClient(telegramAPI).R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(reqSender).SetResult(resSender).SetError(resSender).
+			SetPathParams(map[string]string{
+				"token":   provider.Token,
+				"chat_id": strconv.FormatInt(room.ChatId, 10),
+			}).
+			Post("/bot{token}/sendMessage?chat_id={chat_id}")
+
+		if errSender == nil && !resSender.OK {
+			errSender = fmt.Errorf("%d %s", resSender.ErrorCode, resSender.Description)
+		}
+	}
+
+	// a failed attachment is recorded in notice_history and not retried, so the message is not sent twice.
+	if errSender == nil {
+		for _, attachment := range req.Attachments {
+			sendTelegramFile(provider, room, attachment)
+		}
+	}
+
+	reqBody, err := json.Marshal(reqSender)
+	if err != nil {
 		return jsonEmpty, jsonEmpty, err
 	}
 
-	if resBody, err = json.Marshal(resSender); err != nil {
+	resBody, err := json.Marshal(resSender)
+	if err != nil {
 		return jsonEmpty, jsonEmpty, err
 	}
+	return string(reqBody), string(resBody), errSender
+}
+
+// sendTelegramFile upload jpeg or png up to 10 MB with sendPhoto, other file up to 50 MB with sendDocument.
+func sendTelegramFile(provider *TelegramProvider, room *TelegramRoom, attachment *NoticeAttachment) {
+	method, field := "sendDocument", "document"
+	if contains(telegramPhotoTypes, attachment.ContentType) && attachment.Size <= telegramPhotoSize {
+		method, field = "sendPhoto", "photo"
+	}
+	if attachment.Size > telegramDocumentSize {
+		attachment.Skip = fmt.Sprintf("telegram file must be at most %d MB", telegramDocumentSize>>20)
+		return
+	}
+
+	resSender := &TelegramResponse{}
+	_, err := newClient(telegramAPI).R().
+		SetFormData(map[string]string{"chat_id": strconv.FormatInt(room.ChatId, 10)}).
+		SetFileReader(field, attachment.Name, bytes.NewReader(attachment.Data)).
+		SetResult(resSender).SetError(resSender).
+		SetPathParams(map[string]string{"token": provider.Token, "method": method}).
+		Post("/bot{token}/{method}")
+	if err == nil && !resSender.OK {
+		err = fmt.Errorf("%d %s", resSender.ErrorCode, resSender.Description)
+	}
+	if err != nil {
+		attachment.Skip = err.Error()
+		return
+	}
+	attachment.Sent = true
+}
 
-	return string(reqBody), string(resBody), err
+// telegramFormat of parse_mode, message is escaped even without template so text never break the entity parser.
+func telegramFormat(mode string) *noticeFormat {
+	switch mode {
+	case "MarkdownV2":
+		return formatMarkdownV2
+	case "Markdown":
+		return formatMarkdown
+	case "HTML":
+		return formatHTML
+	default:
+		return formatPlain
+	}
 }
@@ -0,0 +1,292 @@
+package notice
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// TemplateSource is a named template of section, it is copied into the queued message
+// so editing the template does not change a message which is not delivered yet.
+type TemplateSource struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// markup is a text which is already formatted for the target, it is not escaped again.
+type markup string
+
+// noticeFormat render a template into the markup of a provider. Text of template and every printed
+// value are escaped, only helper bold, italic, code and link produce formatting.
+type noticeFormat struct {
+	escape func(s string) string
+	bold   func(s string) string
+	italic func(s string) string
+	code   func(raw string) string
+	link   func(href string, text string) string
+}
+
+const templateOutputSize = 64 << 10
+
+var errTemplateSize = fmt.Errorf("template output is larger than %d bytes", templateOutputSize)
+
+var (
+	rxMarkdownV2     = regexp.MustCompile("([_*\\[\\]()~`>#+\\-=|{}.!\\\\])")
+	rxMarkdownV2Code = regexp.MustCompile("([`\\\\])")
+	rxMarkdown       = regexp.MustCompile("([_*`\\[])")
+	slackEscape      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+var (
+	formatPlain = &noticeFormat{
+		escape: func(s string) string { return s },
+		bold:   func(s string) string { return s },
+		italic: func(s string) string { return s },
+		code:   func(raw string) string { return raw },
+		link: func(href string, text string) string {
+			if text == href {
+				return href
+			}
+			return fmt.Sprintf("%s (%s)", text, href)
+		},
+	}
+
+	// formatMarkdownV2 https://core.telegram.org/bots/api#markdownv2-style
+	formatMarkdownV2 = &noticeFormat{
+		escape: func(s string) string { return rxMarkdownV2.ReplaceAllString(s, `\$1`) },
+		bold:   func(s string) string { return "*" + s + "*" },
+		italic: func(s string) string { return "_" + s + "_" },
+		code:   func(raw string) string { return "`" + rxMarkdownV2Code.ReplaceAllString(raw, `\$1`) + "`" },
+		link: func(href string, text string) string {
+			return fmt.Sprintf("[%s](%s)", text, strings.NewReplacer(`\`, `\\`, `)`, `\)`).Replace(href))
+		},
+	}
+
+	// formatMarkdown https://core.telegram.org/bots/api#markdown-style, entity can not be escaped inside.
+	formatMarkdown = &noticeFormat{
+		escape: func(s string) string { return rxMarkdown.ReplaceAllString(s, `\$1`) },
+		bold:   func(s string) string { return "*" + s + "*" },
+		italic: func(s string) string { return "_" + s + "_" },
+		code:   func(raw string) string { return "`" + strings.ReplaceAll(raw, "`", "'") + "`" },
+		link: func(href string, text string) string {
+			return fmt.Sprintf("[%s](%s)", text, strings.ReplaceAll(href, ")", "%29"))
+		},
+	}
+
+	formatHTML = &noticeFormat{
+		escape: html.EscapeString,
+		bold:   func(s string) string { return "<b>" + s + "</b>" },
+		italic: func(s string) string { return "<i>" + s + "</i>" },
+		code:   func(raw string) string { return "<code>" + html.EscapeString(raw) + "</code>" },
+		link: func(href string, text string) string {
+			return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), text)
+		},
+	}
+
+	// formatEmail is html which keep line break of text.
+	formatEmail = &noticeFormat{
+		escape: func(s string) string { return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>\n") },
+		bold:   formatHTML.bold,
+		italic: formatHTML.italic,
+		code:   formatHTML.code,
+		link:   formatHTML.link,
+	}
+
+	// formatSlack https://api.slack.com/reference/surfaces/formatting#escaping
+	formatSlack = &noticeFormat{
+		escape: slackEscape.Replace,
+		bold:   func(s string) string { return "*" + s + "*" },
+		italic: func(s string) string { return "_" + s + "_" },
+		code:   func(raw string) string { return "`" + slackEscape.Replace(strings.ReplaceAll(raw, "`", "'")) + "`" },
+		link: func(href string, text string) string {
+			return fmt.Sprintf("<%s|%s>", slackEscape.Replace(href), strings.ReplaceAll(text, "|", " "))
+		},
+	}
+)
+
+// noticeFormats name of format for template preview.
+var noticeFormats = map[string]*noticeFormat{
+	"plain":       formatPlain,
+	"markdown":    formatMarkdown,
+	"markdown-v2": formatMarkdownV2,
+	"html":        formatHTML,
+	"email":       formatEmail,
+	"slack":       formatSlack,
+}
+
+// formatMessage body of message in format, message without template is a plain text which is escaped.
+// Message of template has acknowledge link in plain text only, so it is appended as a link of the format.
+func formatMessage(req *RequestNotice, f *noticeFormat) (string, error) {
+	if req.Source == nil {
+		return f.escape(req.Message), nil
+	}
+	body, err := f.render(req.Source.Body, req.Variables)
+	if err != nil || req.AckURL == "" || !safeLink(req.AckURL) {
+		return body, err
+	}
+	return body + f.escape("\n\n") + f.link(req.AckURL, f.escape("Acknowledge")), nil
+}
+
+// renderTemplate set message and subject of request with plain text of template,
+// so provider without formatting, webhook and history use the rendered text.
+func (req *RequestNotice) renderTemplate(source *TemplateSource) error {
+	body, err := formatPlain.render(source.Body, req.Variables)
+	if err != nil {
+		return err
+	}
+	req.Source = source
+	req.Message = body
+
+	if req.Subject == "" && source.Subject != "" {
+		subject, err := formatPlain.render(source.Subject, req.Variables)
+		if err != nil {
+			return err
+		}
+		req.Subject = strings.Join(strings.Fields(subject), " ")
+	}
+	return nil
+}
+
+func (f *noticeFormat) parse(source string) (*template.Template, error) {
+	return template.New("notice").Funcs(f.funcs()).Option("missingkey=error").Parse(source)
+}
+
+// render execute template with variables of request, every value is escaped for the format.
+func (f *noticeFormat) render(source string, variables map[string]any) (string, error) {
+	tmpl, err := f.parse(source)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			f.escapeTree(t.Tree, t.Tree.Root)
+		}
+	}
+
+	out := &limitWriter{limit: templateOutputSize}
+	if err := tmpl.Execute(out, variables); err != nil {
+		if errors.Is(err, errTemplateSize) {
+			return "", errTemplateSize
+		}
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// escapeTree escape text of template and append escape to every action which print a value, like html/template.
+func (f *noticeFormat) escapeTree(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			f.escapeTree(tree, child)
+		}
+	case *parse.TextNode:
+		n.Text = []byte(f.escape(string(n.Text)))
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		escape := parse.NewIdentifier("escape").SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{escape}})
+	case *parse.IfNode:
+		f.escapeTree(tree, n.List)
+		f.escapeTree(tree, n.ElseList)
+	case *parse.RangeNode:
+		f.escapeTree(tree, n.List)
+		f.escapeTree(tree, n.ElseList)
+	case *parse.WithNode:
+		f.escapeTree(tree, n.List)
+		f.escapeTree(tree, n.ElseList)
+	}
+}
+
+func (f *noticeFormat) funcs() template.FuncMap {
+	return template.FuncMap{
+		"escape": f.value,
+		"bold": func(v any) markup {
+			return markup(f.bold(string(f.value(v))))
+		},
+		"italic": func(v any) markup {
+			return markup(f.italic(string(f.value(v))))
+		},
+		"code": func(v any) markup {
+			return markup(f.code(toText(v)))
+		},
+		"link": func(href any, text ...any) markup {
+			value := toText(href)
+			label := f.value(value)
+			if len(text) > 0 {
+				label = f.value(text[0])
+			}
+			if !safeLink(value) {
+				return label
+			}
+			return markup(f.link(value, string(label)))
+		},
+		"upper": func(v any) string { return strings.ToUpper(toText(v)) },
+		"lower": func(v any) string { return strings.ToLower(toText(v)) },
+		"json": func(v any) (string, error) {
+			return jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(v)
+		},
+	}
+}
+
+// value escape v for the format unless it is a markup of helper.
+func (f *noticeFormat) value(v any) markup {
+	if m, ok := v.(markup); ok {
+		return m
+	}
+	return markup(f.escape(toText(v)))
+}
+
+func toText(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case markup:
+		return string(s)
+	case string:
+		return s
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// safeLink allow only link which can not run script in html.
+func safeLink(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto", "tg":
+		return u.Opaque != "" || u.Host != ""
+	default:
+		return false
+	}
+}
+
+// limitWriter stop template which produce a large output.
+type limitWriter struct {
+	strings.Builder
+	limit int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.limit {
+		return 0, errTemplateSize
+	}
+	return w.Builder.Write(p)
+}
@@ -0,0 +1,161 @@
+package notice
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatRender(t *testing.T) {
+	variables := map[string]any{
+		"value": "1.5 *x* <b>&",
+		"name":  "a_b",
+		"code":  "x`y<z>",
+		"url":   "https://touno.io/a_(b)",
+		"lines": "a\nb",
+	}
+
+	tests := []struct {
+		format string
+		source string
+		want   string
+	}{
+		{"plain", "{{ .value }}", "1.5 *x* <b>&"},
+		{"markdown", "{{ .value }}", `1.5 \*x\* <b>&`},
+		{"markdown-v2", "{{ .value }}", `1\.5 \*x\* <b\>&`},
+		{"html", "{{ .value }}", "1.5 *x* &lt;b&gt;&amp;"},
+		{"email", "{{ .value }}", "1.5 *x* &lt;b&gt;&amp;"},
+		{"slack", "{{ .value }}", "1.5 *x* &lt;b&gt;&amp;"},
+
+		{"plain", "v1.0 <ok>", "v1.0 <ok>"},
+		{"markdown-v2", "v1.0 <ok>", `v1\.0 <ok\>`},
+		{"html", "v1.0 <ok>", "v1.0 &lt;ok&gt;"},
+		{"slack", "v1.0 <ok>", "v1.0 &lt;ok&gt;"},
+
+		{"plain", "{{ bold .name }}", "a_b"},
+		{"markdown", "{{ bold .name }}", `*a\_b*`},
+		{"markdown-v2", "{{ italic .name }}", `_a\_b_`},
+		{"html", "{{ bold .name }}", "<b>a_b</b>"},
+		{"slack", "{{ italic .name }}", "_a_b_"},
+
+		{"plain", "{{ code .code }}", "x`y<z>"},
+		{"markdown", "{{ code .code }}", "`x'y<z>`"},
+		{"markdown-v2", "{{ code .code }}", "`x\\`y<z>`"},
+		{"html", "{{ code .code }}", "<code>x`y&lt;z&gt;</code>"},
+		{"slack", "{{ code .code }}", "`x'y&lt;z&gt;`"},
+
+		{"plain", `{{ link .url "Open" }}`, "Open (https://touno.io/a_(b))"},
+		{"markdown", `{{ link .url "Open" }}`, "[Open](https://touno.io/a_(b%29)"},
+		{"markdown-v2", `{{ link .url "Open" }}`, `[Open](https://touno.io/a_(b\))`},
+		{"html", `{{ link .url "Open" }}`, `<a href="https://touno.io/a_(b)">Open</a>`},
+		{"slack", `{{ link .url "Open" }}`, "<https://touno.io/a_(b)|Open>"},
+		{"html", `{{ link "javascript:alert(1)" "x<y" }}`, "x&lt;y"},
+
+		{"email", "{{ .lines }}", "a<br>\nb"},
+		{"html", "{{ upper .name }} {{ json .name }}", `A_B &#34;a_b&#34;`},
+		{"html", "{{ if .name }}<{{ .name }}>{{ end }}", "&lt;a_b&gt;"},
+		{"html", "{{ range .list }}x{{ else }}<none>{{ end }}", "&lt;none&gt;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.source, func(t *testing.T) {
+			vars := map[string]any{"list": []string{}}
+			for k, v := range variables {
+				vars[k] = v
+			}
+			got, err := noticeFormats[tt.format].render(tt.source, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRenderError(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"syntax", "{{ .name "},
+		{"missing variable", "{{ .missing }}"},
+		{"unknown func", "{{ exec .name }}"},
+		{"output is too large", `{{ range .list }}{{ .name }}{{ end }}`},
+	}
+
+	list := make([]int, templateOutputSize)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := formatHTML.render(tt.source, map[string]any{"name": "a", "list": list}); err == nil {
+				t.Error("render() has no error")
+			}
+		})
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *RequestNotice
+		f    *noticeFormat
+		want string
+	}{
+		{"message is escaped", &RequestNotice{Message: "1 < 2"}, formatHTML, "1 &lt; 2"},
+		{"message of template", &RequestNotice{Message: "ignored", Source: &TemplateSource{Body: "{{ bold .v }}"}, Variables: map[string]any{"v": "<up>"}}, formatHTML, "<b>&lt;up&gt;</b>"},
+		{"acknowledge link", &RequestNotice{Source: &TemplateSource{Body: "down"}, AckURL: "https://touno.io/notice/ack/abc"}, formatMarkdownV2, "down\n\n[Acknowledge](https://touno.io/notice/ack/abc)"},
+		{"unsafe acknowledge link", &RequestNotice{Source: &TemplateSource{Body: "down"}, AckURL: "javascript:alert(1)"}, formatHTML, "down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatMessage(tt.req, tt.f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("formatMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	req := &RequestNotice{Variables: map[string]any{"host": "api <1>"}}
+	err := req.renderTemplate(&TemplateSource{Subject: "Down\n  {{ .host }}", Body: "{{ bold .host }} is down"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Subject != "Down api <1>" || req.Message != "api <1> is down" || req.Source == nil {
+		t.Errorf("renderTemplate() = %q %q, want plain text", req.Subject, req.Message)
+	}
+
+	req = &RequestNotice{Subject: "kept", Variables: map[string]any{"host": "api"}}
+	if err := req.renderTemplate(&TemplateSource{Subject: "{{ .host }}", Body: "{{ .host }}"}); err != nil || req.Subject != "kept" {
+		t.Errorf("renderTemplate() subject = %q %v, want subject of request", req.Subject, err)
+	}
+}
+
+func TestSafeLink(t *testing.T) {
+	tests := []struct {
+		href string
+		want bool
+	}{
+		{"https://touno.io", true},
+		{"http://touno.io/a?b=c", true},
+		{"mailto:admin@touno.io", true},
+		{"tg://resolve?domain=touno", true},
+		{"javascript:alert(1)", false},
+		{"data:text/html,<b>", false},
+		{"https://", false},
+		{"/relative", false},
+		{"", false},
+		{strings.Repeat("%", 3), false},
+	}
+
+	for _, tt := range tests {
+		if got := safeLink(tt.href); got != tt.want {
+			t.Errorf("safeLink(%s) = %v, want %v", tt.href, got, tt.want)
+		}
+	}
+}
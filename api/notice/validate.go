@@ -0,0 +1,379 @@
+package notice
+
+import (
+	"crypto/elliptic"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// errSeal is a server error when secret can not be sealed, other error of Validate is a bad request.
+var errSeal = errors.New("secret")
+
+var (
+	rxSectionName   = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9\-_.]{0,19}$`)
+	rxHeaderName    = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9a-zA-Z]+$")
+	telegramModes   = []string{"", "MarkdownV2", "Markdown", "HTML"}
+	webhookMethods  = []string{resty.MethodPost, resty.MethodPut, resty.MethodPatch, resty.MethodGet}
+	noticeProviders = []string{TELEGRAM, SLACK, MSTEAM, LINE, LINENOTIFY, WORKPLACE, EMAIL, WEBHOOK, NATIVE}
+)
+
+// ValidateProvider decode o_param of provider type and return normalized json with sealed secrets,
+// previous is stored o_param when update so masked secrets are kept.
+func ValidateProvider(eType string, param []byte, previous []byte) (string, error) {
+	if !contains(noticeProviders, eType) {
+		return "", fmt.Errorf("type '%s' is not supported", eType)
+	}
+
+	switch eType {
+	case TELEGRAM:
+		provider := new(TelegramProvider)
+		return normalizeParam(param, previous, provider, func() error {
+			if provider.WebhookSecret != "" && !rxTelegramSecret.MatchString(provider.WebhookSecret) {
+				return fmt.Errorf("param.webhook_secret must be 1-256 letters, numbers, '_' or '-'")
+			}
+			return required("token", provider.Token)
+		})
+	case SLACK:
+		provider := new(SlackProvider)
+		return normalizeParam(param, previous, provider, func() error {
+			return required("token", provider.Token)
+		})
+	case LINE:
+		provider := new(LineProvider)
+		return normalizeParam(param, previous, provider, func() error {
+			return required("token", provider.Token)
+		})
+	case WORKPLACE:
+		provider := new(WorkplaceProvider)
+		return normalizeParam(param, previous, provider, func() error {
+			return required("token", provider.Token)
+		})
+	case EMAIL:
+		provider := new(EmailProvider)
+		return normalizeParam(param, previous, provider, func() error {
+			if err := required("smtp", provider.SMTP); err != nil {
+				return err
+			}
+			if provider.Port <= 0 || provider.Port > 65535 {
+				return fmt.Errorf("param.port must be between 1 and 65535")
+			}
+			return nil
+		})
+	case WEBHOOK:
+		provider := new(WebhookProvider)
+		return normalizeParam(param, previous, provider, func() error {
+			return validateWebhook(provider)
+		})
+	case NATIVE:
+		provider := new(NativeProvider)
+		return normalizeParam(param, previous, provider, func() error {
+			return validateNative(provider, len(previous) == 0)
+		})
+	default:
+		return normalizeParam(param, previous, &struct{}{}, nil)
+	}
+}
+
+// ValidateRoom decode o_param of room for provider type and return normalized json with sealed secrets.
+func ValidateRoom(eType string, param []byte, previous []byte) (string, error) {
+	switch eType {
+	case TELEGRAM:
+		room := new(TelegramRoom)
+		return normalizeParam(param, previous, room, func() error {
+			if room.ChatId == 0 {
+				return fmt.Errorf("param.chatId is required")
+			}
+			if !contains(telegramModes, room.Mode) {
+				return fmt.Errorf("param.mode '%s' is not supported", room.Mode)
+			}
+			return nil
+		})
+	case SLACK:
+		room := new(SlackRoom)
+		return normalizeParam(param, previous, room, func() error {
+			return required("channel", room.Channel)
+		})
+	case MSTEAM:
+		room := new(MSTeamRoom)
+		return normalizeParam(param, previous, room, func() error {
+			return validateURL("webhook", room.Webhook)
+		})
+	case LINE:
+		room := new(LineRoom)
+		return normalizeParam(param, previous, room, func() error {
+			return required("to", room.To)
+		})
+	case LINENOTIFY:
+		room := new(LineNotifyRoom)
+		return normalizeParam(param, previous, room, func() error {
+			return required("token", room.Token)
+		})
+	case WORKPLACE:
+		room := new(WorkplaceRoom)
+		return normalizeParam(param, previous, room, func() error {
+			if (room.Thread == "") == (room.ID == "") {
+				return fmt.Errorf("param.thread or param.id is required")
+			}
+			return nil
+		})
+	case EMAIL:
+		room := new(EmailRoom)
+		return normalizeParam(param, previous, room, func() error {
+			if _, err := mail.ParseAddress(room.To); err != nil {
+				return fmt.Errorf("param.to %s", err)
+			}
+			if _, err := mail.ParseAddress(room.From); err != nil {
+				return fmt.Errorf("param.from %s", err)
+			}
+			return nil
+		})
+	default:
+		room := new(struct {
+			Name string `json:"name"`
+		})
+		return normalizeParam(param, previous, room, nil)
+	}
+}
+
+func ValidateSection(name string) error {
+	if !rxSectionName.MatchString(name) {
+		return fmt.Errorf("name must be letters, numbers, '-', '_' or '.' and at most 20 characters")
+	}
+	return nil
+}
+
+// ValidateTemplate check name and parse subject and body, helper functions are same for every format.
+func ValidateTemplate(req *RequestTemplate) error {
+	if !rxSectionName.MatchString(req.Name) {
+		return fmt.Errorf("name must be letters, numbers, '-', '_' or '.' and at most 20 characters")
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		return fmt.Errorf("body is required")
+	}
+	if _, err := formatPlain.parse(req.Subject); err != nil {
+		return fmt.Errorf("subject %s", err)
+	}
+	if _, err := formatPlain.parse(req.Body); err != nil {
+		return fmt.Errorf("body %s", err)
+	}
+	return nil
+}
+
+// ValidatePolicy nil policy is not changed.
+func ValidatePolicy(policy *NoticePolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.RateLimit < 0 || policy.RateWindow < 0 || policy.DedupWindow < 0 || policy.Digest < 0 {
+		return fmt.Errorf("policy must not be negative")
+	}
+	if (policy.RateLimit > 0) != (policy.RateWindow > 0) {
+		return fmt.Errorf("policy.rate_limit and policy.rate_window must be set together")
+	}
+	if policy.RateWindow > maxPolicyWindow || policy.Digest > maxPolicyWindow {
+		return fmt.Errorf("policy.rate_window and policy.digest must be at most %d seconds", maxPolicyWindow)
+	}
+	if policy.DedupWindow > maxDedupWindow {
+		return fmt.Errorf("policy.dedup_window must be at most %d seconds", maxDedupWindow)
+	}
+	return nil
+}
+
+// ValidateSeverity normalize severity of request, empty is info.
+func ValidateSeverity(req *RequestNotice) error {
+	req.Severity = strings.ToLower(strings.TrimSpace(req.Severity))
+	if req.Severity == "" {
+		req.Severity = SeverityInfo
+	}
+	if !contains(severities, req.Severity) {
+		return fmt.Errorf("severity must be %s", strings.Join(severities, ", "))
+	}
+	return nil
+}
+
+// ValidateSubscriber check minimum severity and quiet window of subscriber, empty severity is info.
+func ValidateSubscriber(req *RequestSubscriber) error {
+	req.Severity = strings.ToLower(strings.TrimSpace(req.Severity))
+	if req.Severity == "" {
+		req.Severity = SeverityInfo
+	}
+	if !contains(severities, req.Severity) {
+		return fmt.Errorf("severity must be %s", strings.Join(severities, ", "))
+	}
+	if req.Quiet == nil {
+		return nil
+	}
+	start, err := parseClock(req.Quiet.Start)
+	if err != nil {
+		return fmt.Errorf("quiet.start must be HH:MM")
+	}
+	end, err := parseClock(req.Quiet.End)
+	if err != nil {
+		return fmt.Errorf("quiet.end must be HH:MM")
+	}
+	if start == end {
+		return fmt.Errorf("quiet.start and quiet.end must not be the same")
+	}
+	if _, err := time.LoadLocation(req.Quiet.TimeZone); err != nil {
+		return fmt.Errorf("quiet.timezone %s", err)
+	}
+	return nil
+}
+
+// ValidateEscalation nil escalation is not changed, rooms of steps are checked by caller.
+func ValidateEscalation(escalation *NoticeEscalation) error {
+	if escalation == nil {
+		return nil
+	}
+	escalation.Severity = strings.ToLower(strings.TrimSpace(escalation.Severity))
+	if escalation.Severity == "" {
+		escalation.Severity = SeverityCritical
+	}
+	if !contains(severities, escalation.Severity) {
+		return fmt.Errorf("escalation.severity must be %s", strings.Join(severities, ", "))
+	}
+	if escalation.Steps == nil {
+		escalation.Steps = []*EscalationStep{}
+	}
+	if len(escalation.Steps) > maxEscalationStep {
+		return fmt.Errorf("escalation.steps must be at most %d", maxEscalationStep)
+	}
+	for i, step := range escalation.Steps {
+		if step == nil || step.Room <= 0 {
+			return fmt.Errorf("escalation.steps[%d].room is required", i)
+		}
+		if step.After <= 0 || step.After > maxEscalationAfter {
+			return fmt.Errorf("escalation.steps[%d].after must be between 1 and %d minutes", i, maxEscalationAfter)
+		}
+	}
+	return nil
+}
+
+// validateNative generate VAPID key when provider is created, public key is always derived from private key.
+func validateNative(provider *NativeProvider, create bool) error {
+	u, err := url.Parse(provider.Subject)
+	if err != nil || (u.Scheme != "mailto" && u.Scheme != "https") || (u.Opaque == "" && u.Host == "") {
+		return fmt.Errorf("param.subject must be mailto or https url")
+	}
+	if provider.PrivateKey == "" {
+		if !create {
+			return fmt.Errorf("param.private_key is required, rotate key with /vapid")
+		}
+		return generateVapid(provider)
+	}
+
+	key, err := parseVapidKey(provider.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("param.%s", err)
+	}
+	provider.PublicKey = base64.RawURLEncoding.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+	return nil
+}
+
+// ValidatePush check endpoint and keys of browser push subscription.
+func ValidatePush(req *RequestPush) error {
+	u, err := url.Parse(req.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("endpoint must be https url")
+	}
+	p256dh, err := decodeBase64URL(req.Keys.P256dh)
+	if err != nil {
+		return fmt.Errorf("keys.p256dh %s", err)
+	}
+	if x, _ := elliptic.Unmarshal(elliptic.P256(), p256dh); x == nil {
+		return fmt.Errorf("keys.p256dh is not a P-256 public key")
+	}
+	auth, err := decodeBase64URL(req.Keys.Auth)
+	if err != nil || len(auth) != pushAuthSize {
+		return fmt.Errorf("keys.auth must be %d bytes in base64url", pushAuthSize)
+	}
+	req.Keys.P256dh = base64.RawURLEncoding.EncodeToString(p256dh)
+	req.Keys.Auth = base64.RawURLEncoding.EncodeToString(auth)
+	return nil
+}
+
+func validateWebhook(provider *WebhookProvider) error {
+	if err := validateURL("url", provider.URL); err != nil {
+		return err
+	}
+
+	provider.Method = strings.ToUpper(provider.Method)
+	if provider.Method != "" && !contains(webhookMethods, provider.Method) {
+		return fmt.Errorf("param.method '%s' is not supported", provider.Method)
+	}
+	for key := range provider.Headers {
+		if !rxHeaderName.MatchString(key) {
+			return fmt.Errorf("param.headers '%s' is invalid header name", key)
+		}
+	}
+	if provider.Body != "" {
+		if _, err := template.New("webhook").Funcs(webhookFuncs).Parse(provider.Body); err != nil {
+			return fmt.Errorf("param.body %s", err)
+		}
+	}
+	return nil
+}
+
+func validateURL(name string, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("param.%s must be http or https url", name)
+	}
+	return nil
+}
+
+func required(name string, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("param.%s is required", name)
+	}
+	return nil
+}
+
+// normalizeParam decode param into typed struct, run validate and encode it back so unknown fields are dropped.
+func normalizeParam(param []byte, previous []byte, value any, validate func() error) (string, error) {
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	if len(param) == 0 {
+		param = []byte(jsonEmpty)
+	}
+	if err := json.Unmarshal(param, value); err != nil {
+		return "", fmt.Errorf("param %s", err)
+	}
+	if len(previous) != 0 {
+		old := reflect.New(reflect.TypeOf(value).Elem()).Interface()
+		if err := json.Unmarshal(previous, old); err != nil {
+			return "", err
+		}
+		if err := keepSecret(value, old); err != nil {
+			return "", err
+		}
+	}
+	if validate != nil {
+		if err := validate(); err != nil {
+			return "", err
+		}
+	}
+	if err := sealSecret(value); err != nil {
+		return "", fmt.Errorf("%w %s", errSeal, err)
+	}
+	return json.MarshalToString(value)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package notice
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/db"
+)
+
+// WebhookProvider body is a text/template over WebhookData, empty body send WebhookData as json.
+type WebhookProvider struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers" secret:"true"`
+	Body    string            `json:"body"`
+	Secret  string            `json:"secret" secret:"true"`
+}
+
+type WebhookData struct {
+	Subject   string         `json:"subject,omitempty"`
+	Message   string         `json:"message"`
+	Section   string         `json:"section"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Severity  string         `json:"severity,omitempty"`
+	AckURL    string         `json:"ack_url,omitempty"`
+	Timestamp int64          `json:"timestamp"`
+}
+
+type WebhookRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+type WebhookResponse struct {
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+}
+
+const (
+	webhookSignature    = "X-Touno-Signature"
+	webhookResponseSize = 1000
+)
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		return jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(v)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// ProviderWebhook send message to any http endpoint, when secret is set body is signed with
+// header 'X-Touno-Signature: t=<unix>,v1=<hex hmac-sha256 of "<unix>.<body>">'.
+func ProviderWebhook(req *RequestNotice, notice db.PGRow) (string, string, error) {
+	provider := new(WebhookProvider)
+	if err := unmarshalNotice(notice, provider, &struct{}{}); err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+	if provider.URL == "" {
+		return jsonEmpty, jsonEmpty, fmt.Errorf("url is required")
+	}
+
+	now := time.Now()
+	body, err := provider.render(&WebhookData{
+		Subject:   req.Subject,
+		Message:   req.Message,
+		Section:   notice["section"],
+		Metadata:  req.Metadata,
+		Severity:  req.Severity,
+		AckURL:    req.AckURL,
+		Timestamp: now.Unix(),
+	})
+	if err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	method := strings.ToUpper(provider.Method)
+	if method == "" {
+		method = resty.MethodPost
+	}
+
+	reqSender := &WebhookRequest{Method: method, URL: provider.URL, Headers: map[string]string{"Content-Type": "application/json"}, Body: body}
+	for key, value := range provider.Headers {
+		reqSender.Headers[key] = value
+	}
+	if provider.Secret != "" {
+		reqSender.Headers[webhookSignature] = WebhookSignature(provider.Secret, now, body)
+	}
+	resSender := &WebhookResponse{}
+
+	res, errSender := newClient("").R().
+		SetHeaders(reqSender.Headers).
+		SetBody(body).
+		Execute(method, provider.URL)
+	if res != nil {
+		resSender.Status = res.StatusCode()
+		resSender.Body = res.String()
+		if len(resSender.Body) > webhookResponseSize {
+			resSender.Body = resSender.Body[:webhookResponseSize]
+		}
+	}
+
+	// signature and custom headers may carry credential, history keep only header names.
+	for key := range reqSender.Headers {
+		if key != "Content-Type" {
+			reqSender.Headers[key] = secretMask
+		}
+	}
+
+	reqBody, resBody, err := senderBody(reqSender, resSender)
+	if err != nil {
+		return reqBody, resBody, err
+	}
+
+	if errSender == nil && res.IsError() {
+		errSender = fmt.Errorf("%s", res.Status())
+	}
+	return reqBody, resBody, errSender
+}
+
+func (p *WebhookProvider) render(data *WebhookData) (string, error) {
+	if p.Body == "" {
+		return jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(data)
+	}
+
+	tmpl, err := template.New("webhook").Funcs(webhookFuncs).Option("missingkey=zero").Parse(p.Body)
+	if err != nil {
+		return "", err
+	}
+
+	body := new(bytes.Buffer)
+	if err := tmpl.Execute(body, data); err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
+
+// WebhookSignature is the value of X-Touno-Signature, receiver should reject old timestamp to prevent replay.
+func WebhookSignature(secret string, timestamp time.Time, body string) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix + "." + body))
+	return fmt.Sprintf("t=%s,v1=%s", unix, hex.EncodeToString(mac.Sum(nil)))
+}
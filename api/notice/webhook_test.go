@@ -0,0 +1,129 @@
+package notice
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/db"
+)
+
+// verifyWebhook check X-Touno-Signature the way a receiver does.
+func verifyWebhook(secret string, header string, body string) bool {
+	var unix, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix + "." + body))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return unix != "" && hmac.Equal([]byte(signature), []byte(expected))
+}
+
+func TestWebhookSignature(t *testing.T) {
+	timestamp := time.Unix(1660000000, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		body   string
+		want   string
+	}{
+		{"empty body", "secret", "", "t=1660000000,v1=70d5efd3b7f5c99c55d54c8fb0b85013c5fe39486e6d67507c1483a276e0351e"},
+		{"json body", "secret", `{"message":"hello"}`, "t=1660000000,v1=897ecd985fe263aca1926946ce975f8578b937e6b4a7e726c729fbc52f28f5a2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WebhookSignature(tt.secret, timestamp, tt.body)
+			if got != tt.want {
+				t.Fatalf("WebhookSignature() = %s, want %s", got, tt.want)
+			}
+			if !verifyWebhook(tt.secret, got, tt.body) {
+				t.Errorf("WebhookSignature() = %s is not verified", got)
+			}
+			if verifyWebhook("other", got, tt.body) || verifyWebhook(tt.secret, got, tt.body+" ") {
+				t.Errorf("WebhookSignature() = %s is verified with other secret or body", got)
+			}
+		})
+	}
+}
+
+func TestWebhookRender(t *testing.T) {
+	data := &WebhookData{
+		Subject:   "Down",
+		Message:   "api is down",
+		Section:   "monitor",
+		Metadata:  map[string]any{"host": "api.touno.io"},
+		Timestamp: 1660000000,
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"json by default", "", `{"subject":"Down","message":"api is down","section":"monitor","metadata":{"host":"api.touno.io"},"timestamp":1660000000}`},
+		{"template", `{{ upper .Section }}: {{ .Message }}`, "MONITOR: api is down"},
+		{"json func", `{"text":{{ json .Message }}}`, `{"text":"api is down"}`},
+		{"metadata", `{{ .Section }} of {{ .Metadata.host }}`, "monitor of api.touno.io"},
+		{"missing key is zero", `[{{ .Severity }}]`, "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&WebhookProvider{Body: tt.body}).render(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("render() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderWebhook(t *testing.T) {
+	var header, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		header, body = r.Header.Get(webhookSignature), string(data)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	provider, _ := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalToString(&WebhookProvider{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Secret:  "secret",
+	})
+	notice := db.PGRow{"provider": provider, "room": "{}", "section": "monitor"}
+
+	reqBody, resBody, err := ProviderWebhook(&RequestNotice{Message: "api is down"}, notice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifyWebhook("secret", header, body) {
+		t.Errorf("signature %s of body %s is not verified", header, body)
+	}
+	if strings.Contains(reqBody, "Bearer token") || strings.Contains(reqBody, header) {
+		t.Errorf("history %s keep value of headers", reqBody)
+	}
+	if !strings.Contains(resBody, `{\"ok\":true}`) {
+		t.Errorf("history %s does not keep response", resBody)
+	}
+}
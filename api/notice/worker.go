@@ -0,0 +1,292 @@
+package notice
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/touno-io/core/db"
+)
+
+const (
+	NOTICE_WORKER               = "NOTICE_WORKER"
+	NOTICE_MAX_ATTEMPT          = "NOTICE_MAX_ATTEMPT"
+	NOTICE_ATTACHMENT_RETENTION = "NOTICE_ATTACHMENT_RETENTION"
+)
+
+const (
+	pollInterval      = time.Second
+	cleanInterval     = time.Minute
+	claimLease        = 5 * time.Minute
+	backoffBase       = 30 * time.Second
+	backoffMax        = time.Hour
+	defaultWorker     = 4
+	defaultMaxAttempt = 5
+	// defaultAttachmentRetention days of attachment data after every delivery of its message is done.
+	defaultAttachmentRetention = 7
+)
+
+// Worker deliver notice_outbox with a pool of goroutine, a claimed row is leased so
+// many instances can share the same outbox and a crashed delivery is retried after the lease.
+type Worker struct {
+	pgx        *db.PGClient
+	size       int
+	maxAttempt int
+	retention  int
+	jobs       chan db.PGRow
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+func WorkerNew(pgx *db.PGClient) *Worker {
+	size := getEnvInt(NOTICE_WORKER, defaultWorker)
+	return &Worker{
+		pgx:        pgx,
+		size:       size,
+		maxAttempt: getEnvInt(NOTICE_MAX_ATTEMPT, defaultMaxAttempt),
+		retention:  getEnvInt(NOTICE_ATTACHMENT_RETENTION, defaultAttachmentRetention),
+		jobs:       make(chan db.PGRow, size),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start poll outbox and deliver in background until Stop.
+func (w *Worker) Start() {
+	for i := 0; i < w.size; i++ {
+		w.wg.Add(1)
+		go w.work()
+	}
+
+	w.wg.Add(1)
+	go w.poll()
+}
+
+// Stop wait running deliveries, claimed rows which are not started wait for their lease.
+func (w *Worker) Stop() {
+	close(w.done)
+	w.wg.Wait()
+}
+
+func (w *Worker) poll() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	cleaned := time.Now()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := flushDigest(w.pgx); err != nil {
+				db.Errorf("Notice::Digest %s", err)
+			}
+			if err := escalate(w.pgx); err != nil {
+				db.Errorf("Notice::Escalation %s", err)
+			}
+			if time.Since(cleaned) >= cleanInterval {
+				if err := cleanCounter(w.pgx); err != nil {
+					db.Errorf("Notice::Counter %s", err)
+				}
+				if err := pruneAttachments(w.pgx, w.retention); err != nil {
+					db.Errorf("Notice::Attachment %s", err)
+				}
+				cleaned = time.Now()
+			}
+
+			free := cap(w.jobs) - len(w.jobs)
+			if free == 0 {
+				continue
+			}
+
+			record, err := w.claim(free)
+			if err != nil {
+				db.Errorf("Notice::Claim %s", err)
+				continue
+			}
+			for _, row := range record {
+				select {
+				case w.jobs <- row:
+				case <-w.done:
+					return
+				}
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Worker) work() {
+	defer w.wg.Done()
+	for {
+		select {
+		case row := <-w.jobs:
+			if err := w.deliver(row); err != nil {
+				db.Errorf("Notice::Outbox %s %s", row["id"], err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// claim lease pending rows which are due, attempt is counted at claim.
+// row which lease is over after its last attempt is dead instead of being sent again.
+func (w *Worker) claim(limit int) ([]db.PGRow, error) {
+	stx, err := w.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stx.Execute(`
+		UPDATE notice_outbox SET e_status = 'DEAD', s_error = COALESCE(s_error, 'lease is over after last attempt'), t_leased = NULL
+		WHERE e_status = 'PENDING' AND t_next <= NOW() AND n_attempt >= $1;
+	`, w.maxAttempt)
+	if db.IsRollback(err, stx) {
+		return nil, err
+	}
+
+	rows, err := stx.Query(`
+		WITH claim AS (
+			UPDATE notice_outbox SET n_attempt = n_attempt + 1, t_next = NOW() + $2 * INTERVAL '1 second', t_leased = NOW() + $2 * INTERVAL '1 second'
+			WHERE id IN (
+				SELECT id FROM notice_outbox
+				WHERE e_status = 'PENDING' AND t_next <= NOW() AND n_attempt < $3
+				ORDER BY t_next LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, notice_message_id, notice_room_id, n_attempt
+		)
+		SELECT
+			cm.id, cm.notice_message_id, cm.notice_room_id, cm.n_attempt, msg.o_request, st.s_name section,
+			COALESCE(pv.e_type::text, '') e_type, COALESCE(pv.o_param, '{}'::jsonb) provider, COALESCE(sr.o_param, '{}'::jsonb) room,
+			COALESCE(sr.b_deleted OR pv.b_deleted, true) b_deleted, `+pushSubscriptions+`
+		FROM claim cm
+		INNER JOIN notice_message msg ON msg.id = cm.notice_message_id
+		INNER JOIN notice_section st ON st.id = msg.notice_section_id
+		LEFT JOIN notice_room sr ON sr.id = cm.notice_room_id
+		LEFT JOIN notice_provider pv ON pv.id = sr.notice_provider_id
+	`, limit, int64(claimLease.Seconds()), w.maxAttempt)
+	if db.IsRollback(err, stx) {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record, err := stx.FetchAll(rows)
+	if db.IsRollback(err, stx) {
+		return nil, err
+	}
+
+	if err := stx.Commit(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// deliver send one outbox row and record the attempt to notice_history,
+// a failure is retried with exponential backoff until max attempt then it is dead.
+// status of outbox is committed before history, so a failed history never send the message again.
+func (w *Worker) deliver(notice db.PGRow) error {
+	attempt := int(notice.ToInt64("n_attempt"))
+
+	var reqBody, resBody string
+	var errSender error
+	var attachments any
+	if notice.ToBoolean("b_deleted") {
+		reqBody, resBody, errSender = jsonEmpty, jsonEmpty, fmt.Errorf("room or provider is deleted")
+		attempt = w.maxAttempt
+	} else {
+		req := new(RequestNotice)
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(notice.ToByte("o_request"), req); err != nil {
+			reqBody, resBody, errSender = jsonEmpty, jsonEmpty, err
+			attempt = w.maxAttempt
+		} else {
+			if len(req.Attachments) > 0 && contains(attachProviders, notice["e_type"]) {
+				errSender = loadAttachments(w.pgx, notice["notice_message_id"], req.Attachments)
+			}
+			if errSender != nil {
+				reqBody, resBody = jsonEmpty, jsonEmpty
+			} else {
+				reqBody, resBody, errSender = safeDeliver(req, notice)
+			}
+			attachments = attachmentHistory(req)
+		}
+	}
+
+	stx, err := w.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	if errSender == nil {
+		err = stx.Execute(`UPDATE notice_outbox SET e_status = 'SENT', s_error = NULL, t_sent = NOW(), t_leased = NULL WHERE id = $1;`, notice["id"])
+	} else if attempt >= w.maxAttempt {
+		db.Errorf("Notice::Outbox %s dead after %d attempt %s", notice["id"], attempt, errSender)
+		err = stx.Execute(`UPDATE notice_outbox SET e_status = 'DEAD', s_error = $2, t_leased = NULL WHERE id = $1;`, notice["id"], errSender.Error())
+	} else {
+		err = stx.Execute(`UPDATE notice_outbox SET s_error = $2, t_next = NOW() + $3 * INTERVAL '1 second', t_leased = NULL WHERE id = $1;`,
+			notice["id"], errSender.Error(), int64(backoff(attempt).Seconds()))
+	}
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	if err := stx.Commit(); err != nil {
+		return err
+	}
+
+	stx, err = w.pgx.Begin(db.LevelDefault)
+	if err != nil {
+		return err
+	}
+
+	err = stx.Execute(`
+		INSERT INTO notice_history (notice_room_id, o_sender, b_sended, notice_outbox_id, n_attempt, o_attachment)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`, notice["notice_room_id"], fmt.Sprintf("[%s,%s]", reqBody, resBody), errSender == nil, notice["id"], notice.ToInt64("n_attempt"), attachments)
+	if db.IsRollback(err, stx) {
+		return err
+	}
+	if err := prunePush(stx, notice["e_type"], resBody); db.IsRollback(err, stx) {
+		return err
+	}
+
+	return stx.Commit()
+}
+
+// safeDeliver keep worker alive when provider panic.
+func safeDeliver(req *RequestNotice, notice db.PGRow) (reqBody string, resBody string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			reqBody, resBody, err = jsonEmpty, jsonEmpty, fmt.Errorf("panic occurred: %v", r)
+		}
+	}()
+	return Deliver(req, notice)
+}
+
+// backoff is base * 2^(attempt-1) up to backoffMax with 10% jitter.
+func backoff(attempt int) time.Duration {
+	delay := backoffBase
+	for i := 1; i < attempt && delay < backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > backoffMax {
+		delay = backoffMax
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+}
+
+func getEnvInt(name string, value int) int {
+	if os.Getenv(name) == "" {
+		return value
+	}
+
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n <= 0 {
+		db.Errorf("ENV::%s must be positive number", name)
+		return value
+	}
+	return n
+}
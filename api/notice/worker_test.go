@@ -0,0 +1,53 @@
+package notice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, backoffBase},
+		{1, backoffBase},
+		{2, 2 * backoffBase},
+		{3, 4 * backoffBase},
+		{5, 16 * backoffBase},
+		{8, backoffMax},
+		{100, backoffMax},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := backoff(tt.attempt)
+			if got < tt.want || got > tt.want+tt.want/10 {
+				t.Fatalf("backoff(%d) = %s, want %s with 10%% jitter", tt.attempt, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestGetEnvInt(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int
+	}{
+		{"not set", "", 5},
+		{"number", "8", 8},
+		{"not a number", "eight", 5},
+		{"zero", "0", 5},
+		{"negative", "-1", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(NOTICE_MAX_ATTEMPT, tt.value)
+			if got := getEnvInt(NOTICE_MAX_ATTEMPT, 5); got != tt.want {
+				t.Errorf("getEnvInt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package notice
+
+import (
+	"fmt"
+
+	"github.com/touno-io/core/db"
+)
+
+type WorkplaceProvider struct {
+	Token string `json:"token" secret:"true"`
+}
+
+// WorkplaceRoom send to group chat with 'thread' or to a member with 'id'.
+type WorkplaceRoom struct {
+	Name   string `json:"name"`
+	Thread string `json:"thread,omitempty"`
+	ID     string `json:"id,omitempty"`
+}
+
+type WorkplaceRecipient struct {
+	ThreadKey string `json:"thread_key,omitempty"`
+	ID        string `json:"id,omitempty"`
+}
+
+type WorkplaceMessage struct {
+	Text string `json:"text"`
+}
+
+type WorkplaceRequest struct {
+	Recipient WorkplaceRecipient `json:"recipient"`
+	Message   WorkplaceMessage   `json:"message"`
+}
+
+type WorkplaceResponse struct {
+	MessageID string `json:"message_id,omitempty"`
+	Error     *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+var workplaceAPI string = "https://graph.workplace.com"
+
+func ProviderWorkplace(req *RequestNotice, notice db.PGRow) (string, string, error) {
+	provider := new(WorkplaceProvider)
+	room := new(WorkplaceRoom)
+	if err := unmarshalNotice(notice, provider, room); err != nil {
+		return jsonEmpty, jsonEmpty, err
+	}
+
+	reqSender := &WorkplaceRequest{
+		Recipient: WorkplaceRecipient{ThreadKey: room.Thread, ID: room.ID},
+		Message:   WorkplaceMessage{Text: noticeText(req)},
+	}
+	resSender := &WorkplaceResponse{}
+
+	res, errSender := newClient(workplaceAPI).R().
+		SetAuthToken(provider.Token).
+		SetHeader("Content-Type", "application/json").
+		SetBody(reqSender).SetResult(resSender).SetError(resSender).
+		Post("/me/messages")
+
+	reqBody, resBody, err := senderBody(reqSender, resSender)
+	if err != nil {
+		return reqBody, resBody, err
+	}
+
+	if errSender == nil && resSender.Error != nil {
+		errSender = fmt.Errorf("%d %s", resSender.Error.Code, resSender.Error.Message)
+	} else if errSender == nil && res.IsError() {
+		errSender = fmt.Errorf("%s", res.Status())
+	}
+	return reqBody, resBody, errSender
+}
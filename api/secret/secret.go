@@ -0,0 +1,231 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	SECRET_KEYS = "SECRET_KEYS"
+)
+
+// Sealed value is 'enc:<kid>:<wrapped data key>:<ciphertext>', data key is random per value and
+// wrapped with the key encryption key 'kid' so keys can rotate by re-wrapping only the data key.
+const sealedPrefix = "enc:"
+
+type keyRing struct {
+	active string
+	keys   map[string][]byte
+}
+
+var (
+	ring     *keyRing
+	ringErr  error
+	ringOnce sync.Once
+)
+
+// getRing parse SECRET_KEYS 'kid:base64,kid:base64' of 32 bytes AES key, the first key is used to seal.
+func getRing() (*keyRing, error) {
+	ringOnce.Do(func() {
+		ring, ringErr = parseRing(os.Getenv(SECRET_KEYS))
+	})
+	return ring, ringErr
+}
+
+func parseRing(env string) (*keyRing, error) {
+	r := &keyRing{keys: map[string][]byte{}}
+	for _, entry := range strings.Split(env, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kid, encoded, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("ENV::%s entry must be 'kid:base64'", SECRET_KEYS)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("ENV::%s key '%s' must be 32 bytes base64", SECRET_KEYS, kid)
+		}
+		if _, ok := r.keys[kid]; ok {
+			return nil, fmt.Errorf("ENV::%s key '%s' is duplicated", SECRET_KEYS, kid)
+		}
+
+		if r.active == "" {
+			r.active = kid
+		}
+		r.keys[kid] = key
+	}
+
+	if r.active == "" {
+		return nil, fmt.Errorf("ENV::%s is not set", SECRET_KEYS)
+	}
+	return r, nil
+}
+
+// IsSealed value is encrypted by Seal, other value is a plain text stored before encryption.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// KeyID of sealed value.
+func KeyID(value string) string {
+	if !IsSealed(value) {
+		return ""
+	}
+	return strings.SplitN(strings.TrimPrefix(value, sealedPrefix), ":", 2)[0]
+}
+
+// Seal encrypt plain with a new data key wrapped by the active key.
+func Seal(plain []byte) (string, error) {
+	r, err := getRing()
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := encrypt(r.keys[r.active], dataKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := encrypt(dataKey, plain)
+	if err != nil {
+		return "", err
+	}
+	return join(r.active, wrapped, data), nil
+}
+
+// Open decrypt sealed value, plain text value is returned as it is.
+func Open(value string) ([]byte, error) {
+	if !IsSealed(value) {
+		return []byte(value), nil
+	}
+
+	r, err := getRing()
+	if err != nil {
+		return nil, err
+	}
+
+	kid, wrapped, data, err := split(value)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("secret key '%s' is not found", kid)
+	}
+
+	dataKey, err := decrypt(key, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(dataKey, data)
+}
+
+// Rewrap seal plain text value and re-wrap data key which is not sealed by the active key,
+// it return true when value is changed.
+func Rewrap(value string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	if !IsSealed(value) {
+		sealed, err := Seal([]byte(value))
+		return sealed, err == nil, err
+	}
+
+	r, err := getRing()
+	if err != nil {
+		return value, false, err
+	}
+
+	kid, wrapped, data, err := split(value)
+	if err != nil {
+		return value, false, err
+	}
+	if kid == r.active {
+		return value, false, nil
+	}
+
+	key, ok := r.keys[kid]
+	if !ok {
+		return value, false, fmt.Errorf("secret key '%s' is not found", kid)
+	}
+	dataKey, err := decrypt(key, wrapped)
+	if err != nil {
+		return value, false, err
+	}
+	wrapped, err = encrypt(r.keys[r.active], dataKey)
+	if err != nil {
+		return value, false, err
+	}
+	return join(r.active, wrapped, data), true, nil
+}
+
+func join(kid string, wrapped []byte, data []byte) string {
+	encoding := base64.RawURLEncoding
+	return fmt.Sprintf("%s%s:%s:%s", sealedPrefix, kid, encoding.EncodeToString(wrapped), encoding.EncodeToString(data))
+}
+
+func split(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("sealed value is malformed")
+	}
+
+	encoding := base64.RawURLEncoding
+	wrapped, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("sealed value is malformed")
+	}
+	data, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("sealed value is malformed")
+	}
+	return parts[0], wrapped, data, nil
+}
+
+// encrypt with AES-256-GCM, nonce is prepended to ciphertext.
+func encrypt(key []byte, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func decrypt(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("sealed value is malformed")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
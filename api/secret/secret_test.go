@@ -0,0 +1,163 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var (
+	key1 = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	key2 = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+)
+
+// useRing replace keys of SECRET_KEYS for a test.
+func useRing(t *testing.T, env string) {
+	t.Helper()
+	r, err := parseRing(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ringOnce.Do(func() {})
+	ring, ringErr = r, nil
+}
+
+func TestParseRing(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		active  string
+		wantErr bool
+	}{
+		{"first key is active", "k2:" + key2 + ", k1:" + key1, "k2", false},
+		{"not set", "", "", true},
+		{"no kid", key1, "", true},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "", true},
+		{"duplicated kid", "k1:" + key1 + ",k1:" + key2, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseRing(tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && r.active != tt.active {
+				t.Errorf("parseRing() active = %s, want %s", r.active, tt.active)
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	useRing(t, "k1:"+key1)
+
+	for _, plain := range []string{"", "token", strings.Repeat("สวัสดี", 100)} {
+		sealed, err := Seal([]byte(plain))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsSealed(sealed) || KeyID(sealed) != "k1" || (plain != "" && strings.Contains(sealed, plain)) {
+			t.Fatalf("Seal(%q) = %s is not sealed by k1", plain, sealed)
+		}
+
+		opened, err := Open(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(opened) != plain {
+			t.Errorf("Open() = %q, want %q", opened, plain)
+		}
+	}
+
+	other, _ := Seal([]byte("token"))
+	again, _ := Seal([]byte("token"))
+	if other == again {
+		t.Error("Seal() of the same plain text is the same value")
+	}
+}
+
+func TestOpenError(t *testing.T) {
+	useRing(t, "k1:"+key1)
+	sealed, err := Seal([]byte("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(sealed, ":")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"plain text is opened as it is", "token", "token", false},
+		{"malformed", "enc:k1:data", "", true},
+		{"unknown kid", strings.Replace(sealed, "enc:k1:", "enc:k9:", 1), "", true},
+		{"tampered data", strings.Join(append(parts[:3:3], parts[2]), ":"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Open(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Open() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	useRing(t, "k1:"+key1)
+	old, err := Seal([]byte("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useRing(t, "k2:"+key2+",k1:"+key1)
+	current, err := Seal([]byte("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		changed bool
+		kid     string
+	}{
+		{"empty is kept", "", false, ""},
+		{"plain text is sealed", "token", true, "k2"},
+		{"old key is re-wrapped", old, true, "k2"},
+		{"active key is kept", current, false, "k2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := Rewrap(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != tt.changed || KeyID(got) != tt.kid {
+				t.Fatalf("Rewrap() = %s %v, want kid '%s' %v", got, changed, tt.kid, tt.changed)
+			}
+			if !changed && got != tt.value {
+				t.Errorf("Rewrap() = %s, value is changed", got)
+			}
+			if tt.value != "" {
+				if opened, err := Open(got); err != nil || string(opened) != "token" {
+					t.Errorf("Open() = %q %v, want token", opened, err)
+				}
+			}
+		})
+	}
+
+	useRing(t, "k2:"+key2)
+	if _, _, err := Rewrap(old); err == nil {
+		t.Error("Rewrap() of removed key has no error")
+	}
+}
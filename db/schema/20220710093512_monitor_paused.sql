@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "monitor" ADD COLUMN "b_paused" boolean NOT NULL DEFAULT false;
+ALTER TABLE "monitor" ADD COLUMN "t_created" timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "monitor" DROP COLUMN "t_created";
+ALTER TABLE "monitor" DROP COLUMN "b_paused";
+-- +goose StatementEnd
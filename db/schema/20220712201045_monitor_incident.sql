@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "monitor" ADD COLUMN "n_threshold" int NOT NULL DEFAULT 3;
+ALTER TABLE "monitor" ADD COLUMN "notice_section_id" int4 DEFAULT NULL;
+ALTER TABLE "monitor" ADD FOREIGN KEY ("notice_section_id") REFERENCES "notice_section" ("id");
+
+CREATE TABLE "monitor_incident" (
+  "id" serial,
+  "monitor_protocal_id" int4 NOT NULL,
+  "n_failures" int NOT NULL DEFAULT 0,
+  "s_message" text NOT NULL DEFAULT '',
+  "t_started" timestamp with time zone NOT NULL,
+  "t_resolved" timestamp with time zone DEFAULT NULL,
+  "n_downtime" int NOT NULL DEFAULT 0,
+  "t_created" timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("id"),
+  FOREIGN KEY ("monitor_protocal_id") REFERENCES "monitor_protocal" ("id")
+);
+
+CREATE INDEX "idx_monitor_incident__resolved" ON "monitor_incident" USING BTREE ("monitor_protocal_id", "t_resolved");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "monitor_incident";
+ALTER TABLE "monitor" DROP COLUMN "notice_section_id";
+ALTER TABLE "monitor" DROP COLUMN "n_threshold";
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "monitor_heartbeat_hourly" (
+  "monitor_protocal_id" int4 NOT NULL,
+  "t_bucket" timestamp with time zone NOT NULL,
+  "n_total" int NOT NULL DEFAULT 0,
+  "n_up" int NOT NULL DEFAULT 0,
+  "n_latency_avg" float8 NOT NULL DEFAULT 0,
+  "n_latency_p50" float8 NOT NULL DEFAULT 0,
+  "n_latency_p95" float8 NOT NULL DEFAULT 0,
+  "n_latency_p99" float8 NOT NULL DEFAULT 0,
+  PRIMARY KEY ("monitor_protocal_id", "t_bucket"),
+  FOREIGN KEY ("monitor_protocal_id") REFERENCES "monitor_protocal" ("id")
+);
+
+CREATE TABLE "monitor_heartbeat_daily" (
+  "monitor_protocal_id" int4 NOT NULL,
+  "t_bucket" timestamp with time zone NOT NULL,
+  "n_total" int NOT NULL DEFAULT 0,
+  "n_up" int NOT NULL DEFAULT 0,
+  "n_latency_avg" float8 NOT NULL DEFAULT 0,
+  "n_latency_p50" float8 NOT NULL DEFAULT 0,
+  "n_latency_p95" float8 NOT NULL DEFAULT 0,
+  "n_latency_p99" float8 NOT NULL DEFAULT 0,
+  PRIMARY KEY ("monitor_protocal_id", "t_bucket"),
+  FOREIGN KEY ("monitor_protocal_id") REFERENCES "monitor_protocal" ("id")
+);
+
+CREATE INDEX "idx_monitor_heartbeat__created" ON "monitor_heartbeat" USING BTREE ("monitor_protocal_id", "t_created");
+CREATE INDEX "idx_monitor_incident__started" ON "monitor_incident" USING BTREE ("t_started");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "idx_monitor_incident__started";
+DROP INDEX "idx_monitor_heartbeat__created";
+DROP TABLE "monitor_heartbeat_daily";
+DROP TABLE "monitor_heartbeat_hourly";
+-- +goose StatementEnd
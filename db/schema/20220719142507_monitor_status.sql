@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "monitor" ADD COLUMN "b_public" boolean NOT NULL DEFAULT false;
+ALTER TABLE "monitor" ADD COLUMN "s_slug" varchar(50) DEFAULT NULL;
+ALTER TABLE "monitor" ADD CONSTRAINT uq_monitor_slug UNIQUE ("s_slug");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "monitor" DROP CONSTRAINT uq_monitor_slug;
+ALTER TABLE "monitor" DROP COLUMN "s_slug";
+ALTER TABLE "monitor" DROP COLUMN "b_public";
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TYPE "opt_monitor" ADD VALUE IF NOT EXISTS 'TLS';
+ALTER TYPE "opt_monitor" ADD VALUE IF NOT EXISTS 'KEYWORD';
+ALTER TYPE "opt_monitor" ADD VALUE IF NOT EXISTS 'DNS';
+ALTER TYPE "opt_monitor" ADD VALUE IF NOT EXISTS 'POSTGRES';
+
+-- +goose Down
+-- enum value can not be dropped without recreate type
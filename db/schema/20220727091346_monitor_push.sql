@@ -0,0 +1,12 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TYPE "opt_monitor" ADD VALUE IF NOT EXISTS 'PUSH';
+
+ALTER TABLE "monitor_protocal" ADD COLUMN "s_token" varchar(32) DEFAULT NULL;
+ALTER TABLE "monitor_protocal" ADD COLUMN "t_pushed" timestamp with time zone DEFAULT NULL;
+ALTER TABLE "monitor_protocal" ADD CONSTRAINT uq_monitor_protocal_token UNIQUE ("s_token");
+
+-- +goose Down
+ALTER TABLE "monitor_protocal" DROP CONSTRAINT uq_monitor_protocal_token;
+ALTER TABLE "monitor_protocal" DROP COLUMN "t_pushed";
+ALTER TABLE "monitor_protocal" DROP COLUMN "s_token";
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "user_token" ADD CONSTRAINT uq_user_token_session UNIQUE ("n_session");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "user_token" DROP CONSTRAINT uq_user_token_session;
+-- +goose StatementEnd
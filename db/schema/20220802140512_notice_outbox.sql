@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE "opt_outbox" AS ENUM (
+  'PENDING',
+  'SENT',
+  'DEAD'
+);
+
+CREATE TABLE "notice_message" (
+  "id" uuid NOT NULL DEFAULT uuid_generate_v4(),
+  "notice_section_id" int4 NOT NULL,
+  "o_request" jsonb NOT NULL,
+  "t_created" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("id"),
+  FOREIGN KEY ("notice_section_id") REFERENCES "notice_section" ("id")
+);
+
+CREATE TABLE "notice_outbox" (
+  "id" serial,
+  "notice_message_id" uuid NOT NULL,
+  "notice_room_id" int4 NOT NULL,
+  "e_status" opt_outbox NOT NULL DEFAULT 'PENDING',
+  "n_attempt" int NOT NULL DEFAULT 0,
+  "s_error" text,
+  "t_next" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "t_sent" timestamp WITH TIME ZONE DEFAULT NULL,
+  "t_created" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("id"),
+  FOREIGN KEY ("notice_message_id") REFERENCES "notice_message" ("id") ON DELETE CASCADE,
+  FOREIGN KEY ("notice_room_id") REFERENCES "notice_room" ("id")
+);
+
+CREATE INDEX "idx_notice_outbox__pending" ON "notice_outbox" USING BTREE ("t_next") WHERE "e_status" = 'PENDING';
+CREATE INDEX "idx_notice_outbox__message" ON "notice_outbox" USING BTREE ("notice_message_id");
+
+ALTER TABLE "notice_history" ADD COLUMN "notice_outbox_id" int4 DEFAULT NULL;
+ALTER TABLE "notice_history" ADD COLUMN "n_attempt" int NOT NULL DEFAULT 1;
+ALTER TABLE "notice_history" ADD FOREIGN KEY ("notice_outbox_id") REFERENCES "notice_outbox" ("id") ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "notice_history" DROP COLUMN "n_attempt";
+ALTER TABLE "notice_history" DROP COLUMN "notice_outbox_id";
+DROP TABLE "notice_outbox";
+DROP TABLE "notice_message";
+DROP TYPE "opt_outbox";
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "notice_history" ADD COLUMN "id" serial PRIMARY KEY;
+CREATE INDEX "idx_notice_history__room" ON "notice_history" USING BTREE ("notice_room_id", "t_created");
+CREATE INDEX "idx_notice_history__outbox" ON "notice_history" USING BTREE ("notice_outbox_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "idx_notice_history__outbox";
+DROP INDEX "idx_notice_history__room";
+ALTER TABLE "notice_history" DROP COLUMN "id";
+-- +goose StatementEnd
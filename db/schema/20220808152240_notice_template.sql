@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "notice_template" (
+  "id" serial PRIMARY KEY,
+  "notice_section_id" int4 NOT NULL,
+  "s_name" varchar(20) NOT NULL,
+  "s_subject" text NOT NULL DEFAULT '',
+  "s_body" text NOT NULL,
+  "t_deleted" timestamp WITH TIME ZONE DEFAULT NULL,
+  "t_created" timestamp WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY ("notice_section_id") REFERENCES "notice_section" ("id")
+);
+
+CREATE UNIQUE INDEX "uq_notice_template" ON "notice_template" USING BTREE ("notice_section_id", "s_name") WHERE "t_deleted" IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "notice_template";
+-- +goose StatementEnd
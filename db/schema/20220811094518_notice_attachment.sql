@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "notice_attachment" (
+  "id" serial PRIMARY KEY,
+  "notice_message_id" uuid NOT NULL,
+  "n_index" int NOT NULL,
+  "s_name" varchar(255) NOT NULL,
+  "s_content_type" varchar(255) NOT NULL,
+  "n_size" int NOT NULL,
+  "s_sha256" varchar(64) NOT NULL,
+  "b_data" bytea NOT NULL,
+  "t_created" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY ("notice_message_id") REFERENCES "notice_message" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX "uq_notice_attachment" ON "notice_attachment" USING BTREE ("notice_message_id", "n_index");
+
+ALTER TABLE "notice_history" ADD COLUMN "o_attachment" jsonb DEFAULT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "notice_history" DROP COLUMN "o_attachment";
+DROP TABLE "notice_attachment";
+-- +goose StatementEnd
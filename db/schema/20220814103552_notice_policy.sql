@@ -0,0 +1,29 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TYPE "opt_outbox" ADD VALUE IF NOT EXISTS 'DIGEST';
+ALTER TYPE "opt_outbox" ADD VALUE IF NOT EXISTS 'DIGESTED';
+
+ALTER TABLE "notice_section" ADD COLUMN "o_policy" jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE "notice_room" ADD COLUMN "o_policy" jsonb NOT NULL DEFAULT '{}';
+
+ALTER TABLE "notice_outbox" ADD COLUMN "notice_digest_id" uuid DEFAULT NULL;
+ALTER TABLE "notice_outbox" ADD FOREIGN KEY ("notice_digest_id") REFERENCES "notice_message" ("id") ON DELETE SET NULL;
+CREATE INDEX "idx_notice_outbox__digest" ON "notice_outbox" USING BTREE ("t_next") WHERE "e_status" = 'DIGEST';
+
+CREATE SCHEMA IF NOT EXISTS "cache";
+CREATE TABLE IF NOT EXISTS "cache"."notice" (
+	s_key  VARCHAR(128) PRIMARY KEY NOT NULL DEFAULT '',
+	n_count  int NOT NULL DEFAULT 0,
+	t_expire  BIGINT NOT NULL DEFAULT '0'
+);
+CREATE INDEX IF NOT EXISTS "idx_notice_expire" ON "cache"."notice" (t_expire);
+
+-- +goose Down
+DROP TABLE "cache"."notice";
+DROP INDEX "idx_notice_outbox__digest";
+ALTER TABLE "notice_outbox" DROP COLUMN "notice_digest_id";
+ALTER TABLE "notice_room" DROP COLUMN "o_policy";
+ALTER TABLE "notice_section" DROP COLUMN "o_policy";
+-- value of enum can not be dropped, digest rows are moved back to outbox.
+UPDATE "notice_outbox" SET "e_status" = 'PENDING' WHERE "e_status" = 'DIGEST';
+UPDATE "notice_outbox" SET "e_status" = 'SENT' WHERE "e_status" = 'DIGESTED';
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE "opt_severity" AS ENUM ('info', 'warning', 'critical');
+
+ALTER TABLE "notice_subscriber" ADD COLUMN "e_severity" opt_severity NOT NULL DEFAULT 'info';
+ALTER TABLE "notice_subscriber" ADD COLUMN "o_quiet" jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE "notice_section" ADD COLUMN "o_escalation" jsonb NOT NULL DEFAULT '{}';
+
+CREATE TABLE "notice_escalation" (
+  "id" serial PRIMARY KEY,
+  "notice_message_id" uuid NOT NULL,
+  "o_steps" jsonb NOT NULL DEFAULT '[]',
+  "n_step" int NOT NULL DEFAULT 0,
+  "s_token" varchar(64) NOT NULL,
+  "t_next" timestamp WITH TIME ZONE DEFAULT NULL,
+  "t_ack" timestamp WITH TIME ZONE DEFAULT NULL,
+  "s_ack" varchar(50) DEFAULT NULL,
+  "t_created" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY ("notice_message_id") REFERENCES "notice_message" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX "uq_notice_escalation__message" ON "notice_escalation" USING BTREE ("notice_message_id");
+CREATE UNIQUE INDEX "uq_notice_escalation__token" ON "notice_escalation" USING BTREE ("s_token");
+CREATE INDEX "idx_notice_escalation__next" ON "notice_escalation" USING BTREE ("t_next") WHERE "t_ack" IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "notice_escalation";
+ALTER TABLE "notice_section" DROP COLUMN "o_escalation";
+ALTER TABLE "notice_subscriber" DROP COLUMN "o_quiet";
+ALTER TABLE "notice_subscriber" DROP COLUMN "e_severity";
+DROP TYPE "opt_severity";
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "notice_room" ADD COLUMN "t_mute" timestamp WITH TIME ZONE DEFAULT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "notice_room" DROP COLUMN "t_mute";
+-- +goose StatementEnd
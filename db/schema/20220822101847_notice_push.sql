@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "notice_push" (
+  "id" serial PRIMARY KEY,
+  "user_id" int4 NOT NULL,
+  "notice_room_id" int4 NOT NULL,
+  "s_endpoint" text NOT NULL,
+  "s_p256dh" varchar(128) NOT NULL,
+  "s_auth" varchar(64) NOT NULL,
+  "s_user_agent" varchar(255) DEFAULT NULL,
+  "t_created" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY ("user_id") REFERENCES "user_account" ("id"),
+  FOREIGN KEY ("notice_room_id") REFERENCES "notice_room" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX "uq_notice_push" ON "notice_push" USING BTREE ("notice_room_id", "s_endpoint");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "notice_push";
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "user_permission" ADD CONSTRAINT uq_user_permission UNIQUE ("s_name");
+ALTER TABLE "user_role" ADD CONSTRAINT uq_user_role UNIQUE ("s_name");
+CREATE UNIQUE INDEX "uq_user_role_permission" ON "user_role_permission" USING BTREE ("user_role_id", "user_permission_id");
+
+CREATE TABLE "user_account_role" (
+  "user_id" int4 NOT NULL,
+  "user_role_id" int4 NOT NULL,
+  "t_created" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("user_id", "user_role_id"),
+  FOREIGN KEY ("user_id") REFERENCES "user_account" ("id") ON DELETE CASCADE,
+  FOREIGN KEY ("user_role_id") REFERENCES "user_role" ("id") ON DELETE CASCADE
+);
+
+INSERT INTO "user_permission" ("s_name") VALUES
+('shorturl:read'), ('shorturl:write'),
+('monitor:read'), ('monitor:write'),
+('notice:read'), ('notice:write')
+ON CONFLICT DO NOTHING;
+
+-- member can only read, contributor can also write. OWNER has every permission without role.
+INSERT INTO "user_role" ("s_name", "n_role") VALUES ('member', 0), ('contributor', 1) ON CONFLICT DO NOTHING;
+
+INSERT INTO "user_role_permission" ("user_role_id", "user_permission_id")
+SELECT ur.id, up.id FROM "user_role" ur, "user_permission" up
+WHERE (ur.s_name = 'member' AND up.s_name LIKE '%:read') OR ur.s_name = 'contributor'
+ON CONFLICT DO NOTHING;
+
+-- only level which is trusted keep access, VISITOR and BANED get no role until OWNER grant it.
+INSERT INTO "user_account_role" ("user_id", "user_role_id")
+SELECT ua.id, ur.id FROM "user_account" ua, "user_role" ur
+WHERE (ua.n_level = 'CONTRIBUTOR' AND ur.s_name = 'contributor') OR (ua.n_level = 'SUPPORTER' AND ur.s_name = 'member');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "user_account_role";
+DROP INDEX "uq_user_role_permission";
+ALTER TABLE "user_role" DROP CONSTRAINT uq_user_role;
+ALTER TABLE "user_permission" DROP CONSTRAINT uq_user_permission;
+-- +goose StatementEnd
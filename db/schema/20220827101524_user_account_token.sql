@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE "opt_account_token" AS ENUM ('VERIFY', 'RESET');
+
+ALTER TABLE "user_account" ADD COLUMN "t_verified" timestamp WITH TIME ZONE DEFAULT NULL;
+-- accounts which were created by migration are trusted.
+UPDATE "user_account" SET "t_verified" = COALESCE("t_created", CURRENT_TIMESTAMP);
+
+CREATE TABLE "user_account_token" (
+  "id" serial PRIMARY KEY,
+  "user_id" int4 NOT NULL,
+  "e_type" opt_account_token NOT NULL,
+  "s_token" varchar(64) NOT NULL,
+  "t_expired" timestamp WITH TIME ZONE NOT NULL,
+  "t_used" timestamp WITH TIME ZONE DEFAULT NULL,
+  "t_created" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY ("user_id") REFERENCES "user_account" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX "uq_user_account_token__token" ON "user_account_token" USING BTREE ("s_token");
+CREATE INDEX "idx_user_account_token__user" ON "user_account_token" USING BTREE ("user_id", "e_type") WHERE "t_used" IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "user_account_token";
+ALTER TABLE "user_account" DROP COLUMN "t_verified";
+DROP TYPE "opt_account_token";
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "user_account_key" (
+  "id" serial PRIMARY KEY,
+  "user_id" int4 NOT NULL,
+  "s_kid" varchar(32) NOT NULL DEFAULT REPLACE(uuid_generate_v4()::text, '-', ''),
+  "a_public_key" bytea NOT NULL,
+  "s_private_key" text NOT NULL,
+  "t_expired" timestamp WITH TIME ZONE DEFAULT NULL,
+  "t_created" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY ("user_id") REFERENCES "user_account" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX "uq_user_account_key__kid" ON "user_account_key" USING BTREE ("s_kid");
+-- key which is not expired is the active key to sign token, the others are kept until their grace period is over.
+CREATE UNIQUE INDEX "uq_user_account_key__active" ON "user_account_key" USING BTREE ("user_id") WHERE "t_expired" IS NULL;
+
+-- private key is base64 of PKCS1 until auth.RotateKeys seal it with SECRET_KEYS at start.
+INSERT INTO "user_account_key" ("user_id", "a_public_key", "s_private_key")
+SELECT "id", "a_public_key", encode("a_private_key", 'base64') FROM "user_account"
+WHERE "a_private_key" IS NOT NULL AND "a_public_key" IS NOT NULL;
+
+ALTER TABLE "user_account" DROP COLUMN "a_private_key";
+ALTER TABLE "user_account" DROP COLUMN "a_public_key";
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "user_account" ADD COLUMN "a_public_key" bytea;
+ALTER TABLE "user_account" ADD COLUMN "a_private_key" bytea;
+
+-- sealed private key can not be decrypted here, account of it has no key after down.
+UPDATE "user_account" ua SET "a_public_key" = uk."a_public_key", "a_private_key" = decode(uk."s_private_key", 'base64')
+FROM "user_account_key" uk
+WHERE uk."user_id" = ua."id" AND uk."t_expired" IS NULL AND uk."s_private_key" NOT LIKE 'enc:%';
+
+DROP TABLE "user_account_key";
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "user_session" ADD COLUMN "t_expired" timestamp WITH TIME ZONE DEFAULT NULL;
+UPDATE "user_session" SET "t_expired" = "t_created" + INTERVAL '1 DAY';
+
+CREATE UNIQUE INDEX "uq_user_session__session" ON "user_session" USING BTREE ("n_session");
+
+-- refresh tokens of a session are a family, the whole session is revoked when a used token is presented again.
+CREATE TABLE "user_session_refresh" (
+  "id" serial PRIMARY KEY,
+  "n_session" uuid NOT NULL,
+  "s_token" varchar(64) NOT NULL,
+  "t_expired" timestamp WITH TIME ZONE NOT NULL,
+  "t_used" timestamp WITH TIME ZONE DEFAULT NULL,
+  "t_created" timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY ("n_session") REFERENCES "user_session" ("n_session") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX "uq_user_session_refresh__token" ON "user_session_refresh" USING BTREE ("s_token");
+CREATE INDEX "idx_user_session_refresh__session" ON "user_session_refresh" USING BTREE ("n_session");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "user_session_refresh";
+DROP INDEX "uq_user_session__session";
+ALTER TABLE "user_session" DROP COLUMN "t_expired";
+-- +goose StatementEnd
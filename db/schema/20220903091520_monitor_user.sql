@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "monitor" ADD COLUMN "user_id" int4 DEFAULT NULL;
+ALTER TABLE "monitor" ADD FOREIGN KEY ("user_id") REFERENCES "user_account" ("id");
+
+-- monitors which were created before they are owned by user belong to OWNER.
+UPDATE "monitor" SET "user_id" = (SELECT "id" FROM "user_account" WHERE "n_level" = 'OWNER' ORDER BY "id" LIMIT 1);
+
+CREATE INDEX "idx_monitor__user" ON "monitor" USING BTREE ("user_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "idx_monitor__user";
+ALTER TABLE "monitor" DROP COLUMN "user_id";
+-- +goose StatementEnd
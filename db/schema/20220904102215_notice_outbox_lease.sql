@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- t_leased is set while a worker deliver the row, so resend can not reset a row in flight.
+ALTER TABLE "notice_outbox" ADD COLUMN "t_leased" timestamp with time zone DEFAULT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "notice_outbox" DROP COLUMN "t_leased";
+-- +goose StatementEnd
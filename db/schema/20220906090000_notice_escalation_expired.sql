@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- acknowledge link is rejected after t_expired, link of existing escalation expire 7 days after it is created.
+ALTER TABLE "notice_escalation" ADD COLUMN "t_expired" timestamp with time zone DEFAULT NULL;
+UPDATE "notice_escalation" SET "t_expired" = "t_created" + INTERVAL '7 days';
+ALTER TABLE "notice_escalation" ALTER COLUMN "t_expired" SET NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "notice_escalation" DROP COLUMN "t_expired";
+-- +goose StatementEnd
@@ -17,6 +17,8 @@ import (
 	"github.com/tmilewski/goenv"
 	"github.com/touno-io/core/api"
 	"github.com/touno-io/core/api/auth"
+	"github.com/touno-io/core/api/monitor"
+	"github.com/touno-io/core/api/notice"
 	"github.com/touno-io/core/api/shorturl"
 	"github.com/touno-io/core/db"
 )
@@ -49,22 +51,35 @@ func main() {
 	pgx.Connect(&ctx, appTitle)
 
 	if _, err := os.Stat("./db/schema"); !os.IsNotExist(err) {
-		if dbVersion, err := goose.EnsureDBVersion(pgx.DB); dbVersion == 0 {
-			if err != nil {
-				db.Trace.Fatal(err)
-			}
-
-			if err = goose.Run("up", pgx.DB, "./db/schema"); err != nil {
-				db.Trace.Fatal(err)
-			}
+		// migration which is newer than db_version is applied at every start, not only on empty database.
+		if err := goose.Up(pgx.DB, "./db/schema"); err != nil {
+			db.Trace.Fatal(err)
 		}
 	}
 
+	scheduler := monitor.SchedulerNew(pgx)
+	scheduler.Start()
+	if err := notice.RotateSecrets(pgx); err != nil {
+		db.Errorf("Notice::RotateSecrets %s", err)
+	}
+	if err := monitor.RotateSecrets(pgx); err != nil {
+		db.Errorf("Monitor::RotateSecrets %s", err)
+	}
+	if err := auth.RotateKeys(pgx); err != nil {
+		db.Errorf("Auth::RotateKeys %s", err)
+	}
+	worker := notice.WorkerNew(pgx)
+	worker.Start()
+
 	engine := html.New("./views", ".html")
+	// fasthttp can stream request body of the whole server only, body of every route but courier group
+	// is read in full by api.HandlerBodyLimit before its handler.
 	app := fiber.New(fiber.Config{
-		Views:                 engine,
-		DisableStartupMessage: true,
-		CaseSensitive:         true,
+		Views:                        engine,
+		DisableStartupMessage:        true,
+		CaseSensitive:                true,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 		ErrorHandler: func(c *fiber.Ctx, e error) error {
 			sentry.CaptureException(e)
 			return nil
@@ -81,8 +96,23 @@ func main() {
 
 	app.Static("/", "./assets")
 	app.Use(api.HanderMiddlewareSecurity)
+
+	// courier group is registered before body limit of app, it limit its body stream with attachments.
+	appCourier := app.Group("/notice")
+	appCourier.Post("/:roomName", notice.HandlerBodyLimit, auth.HandlerCourierMiddleware(pgx), notice.HandlerNoticeMessage(pgx))
+
+	app.Use(api.HandlerBodyLimit(fiber.DefaultBodyLimit))
 	app.Get("/health", api.HandlerHealth)
 	app.Get("/s/:hash", shorturl.HandlerRedirectURL(pgx))
+	app.Get("/status", monitor.HandlerStatusPage(pgx))
+	app.Get("/status.json", monitor.HandlerStatusJSON(pgx))
+	app.Get("/status/:slug.json", monitor.HandlerStatusJSON(pgx))
+	app.Get("/status/:slug", monitor.HandlerStatusPage(pgx))
+	app.Get("/.well-known/jwks.json", auth.HandlerJWKS(pgx))
+	app.Get("/.well-known/openid-configuration", auth.HandlerOpenIDConfiguration)
+	app.Get("/notice/ack/:token", notice.HandlerAckPage(pgx))
+	app.Post("/notice/ack/:token", notice.HandlerAckNotice(pgx))
+	app.Post("/notice/telegram/:id", notice.HandlerTelegramWebhook(pgx))
 
 	appV1 := app.Group("/v1")
 
@@ -97,14 +127,75 @@ func main() {
 	}), auth.HandlerV1BasicSignIn(pgx, storeSession))
 
 	appAuth.Get("/account", auth.HandlerAuthMiddleware(pgx, storeSession), auth.HandlerV1UserInfo(pgx))
+	appAuth.Post("/refresh", auth.HandlerV1Refresh(pgx, storeSession))
+	appAuth.Post("/signup", auth.HandlerV1SignUp(pgx))
+	appAuth.Post("/verify", auth.HandlerV1Verify(pgx))
+	appAuth.Get("/verify/:token", auth.HandlerV1VerifyPage(pgx))
+	appAuth.Post("/verify/resend", auth.HandlerV1ResendVerify(pgx))
+	appAuth.Post("/password/forgot", auth.HandlerV1ForgotPassword(pgx))
+	appAuth.Get("/password/reset/:token", auth.HandlerV1ResetPasswordPage(pgx))
+	appAuth.Post("/password/reset", auth.HandlerV1ResetPassword(pgx, storeSession))
+	appAuth.Post("/password/reset/:token", auth.HandlerV1ResetPassword(pgx, storeSession))
+	appAuth.Put("/password", auth.HandlerAuthMiddleware(pgx, storeSession), auth.HandlerV1ChangePassword(pgx, storeSession))
+	appAuth.Get("/role", auth.HandlerAuthMiddleware(pgx, storeSession), auth.HandlerV1GetRole(pgx))
+	appAuth.Put("/role", auth.HandlerAuthMiddleware(pgx, storeSession), auth.HandlerV1GrantRole(pgx))
+	appAuth.Get("/key", auth.HandlerAuthMiddleware(pgx, storeSession), auth.HandlerV1GetKey(pgx))
+	appAuth.Post("/key/rotate", auth.HandlerAuthMiddleware(pgx, storeSession), auth.HandlerV1RotateKey(pgx))
 	appAuth.Delete("/", auth.HandlerAuthMiddleware(pgx, storeSession), auth.HandlerV1SignOut(pgx, storeSession))
 
-	appApi := app.Group("/api", func(c *fiber.Ctx) error {
-		return c.Next()
-	})
-
-	appApi.Get("/url", shorturl.HandlerGetURL(pgx))
-	appApi.Post("/url", shorturl.HandlerAddURL(pgx))
+	// push url is called by cron jobs with the secret token only, so it is mounted before the authorized group.
+	appV1.Get("/monitor/push/:token", monitor.HandlerPush(pgx))
+	appV1.Post("/monitor/push/:token", monitor.HandlerPush(pgx))
+	appMonitor := appV1.Group("/monitor", auth.HandlerAuthMiddleware(pgx, storeSession))
+	appMonitor.Get("/", auth.RequirePermission("monitor:read"), monitor.HandlerGetMonitor(pgx))
+	appMonitor.Post("/", auth.RequirePermission("monitor:write"), monitor.HandlerAddMonitor(pgx))
+	appMonitor.Get("/:id", auth.RequirePermission("monitor:read"), monitor.HandlerGetMonitorByID(pgx))
+	appMonitor.Put("/:id", auth.RequirePermission("monitor:write"), monitor.HandlerUpdateMonitor(pgx))
+	appMonitor.Delete("/:id", auth.RequirePermission("monitor:write"), monitor.HandlerDeleteMonitor(pgx))
+	appMonitor.Get("/:id/uptime", auth.RequirePermission("monitor:read"), monitor.HandlerGetUptime(pgx))
+	appMonitor.Post("/:id/pause", auth.RequirePermission("monitor:write"), monitor.HandlerPauseMonitor(pgx, true))
+	appMonitor.Post("/:id/resume", auth.RequirePermission("monitor:write"), monitor.HandlerPauseMonitor(pgx, false))
+	appMonitor.Post("/:id/protocol", auth.RequirePermission("monitor:write"), monitor.HandlerAddProtocol(pgx))
+	appMonitor.Put("/:id/protocol/:protocolId", auth.RequirePermission("monitor:write"), monitor.HandlerUpdateProtocol(pgx))
+	appMonitor.Delete("/:id/protocol/:protocolId", auth.RequirePermission("monitor:write"), monitor.HandlerDeleteProtocol(pgx))
+
+	appNotice := appV1.Group("/notice", auth.HandlerAuthMiddleware(pgx, storeSession))
+	appNotice.Get("/message/:id", auth.RequirePermission("notice:read"), notice.HandlerGetMessage(pgx))
+	appNotice.Post("/message/:id/ack", auth.RequirePermission("notice:write"), notice.HandlerAckMessage(pgx))
+	appNotice.Get("/history", auth.RequirePermission("notice:read"), notice.HandlerGetHistory(pgx))
+	appNotice.Post("/outbox/:id/resend", auth.RequirePermission("notice:write"), notice.HandlerResendOutbox(pgx))
+	appNotice.Get("/provider", auth.RequirePermission("notice:read"), notice.HandlerGetProvider(pgx))
+	appNotice.Post("/provider", auth.RequirePermission("notice:write"), notice.HandlerAddProvider(pgx))
+	appNotice.Get("/provider/:id", auth.RequirePermission("notice:read"), notice.HandlerGetProviderByID(pgx))
+	appNotice.Put("/provider/:id", auth.RequirePermission("notice:write"), notice.HandlerUpdateProvider(pgx))
+	appNotice.Delete("/provider/:id", auth.RequirePermission("notice:write"), notice.HandlerDeleteProvider(pgx))
+	appNotice.Post("/provider/:id/vapid", auth.RequirePermission("notice:write"), notice.HandlerRotateVapid(pgx))
+	appNotice.Get("/room", auth.RequirePermission("notice:read"), notice.HandlerGetRoom(pgx))
+	appNotice.Post("/room", auth.RequirePermission("notice:write"), notice.HandlerAddRoom(pgx))
+	appNotice.Get("/room/:id", auth.RequirePermission("notice:read"), notice.HandlerGetRoomByID(pgx))
+	appNotice.Put("/room/:id", auth.RequirePermission("notice:write"), notice.HandlerUpdateRoom(pgx))
+	appNotice.Delete("/room/:id", auth.RequirePermission("notice:write"), notice.HandlerDeleteRoom(pgx))
+	appNotice.Post("/room/:id/test", auth.RequirePermission("notice:write"), notice.HandlerTestRoom(pgx))
+	appNotice.Get("/room/:id/push", auth.RequirePermission("notice:read"), notice.HandlerGetPush(pgx))
+	appNotice.Post("/room/:id/push", auth.RequirePermission("notice:write"), notice.HandlerAddPush(pgx))
+	appNotice.Delete("/room/:id/push", auth.RequirePermission("notice:write"), notice.HandlerDeletePush(pgx))
+	appNotice.Get("/section", auth.RequirePermission("notice:read"), notice.HandlerGetSection(pgx))
+	appNotice.Post("/section", auth.RequirePermission("notice:write"), notice.HandlerAddSection(pgx))
+	appNotice.Get("/section/:id", auth.RequirePermission("notice:read"), notice.HandlerGetSectionByID(pgx))
+	appNotice.Put("/section/:id", auth.RequirePermission("notice:write"), notice.HandlerUpdateSection(pgx))
+	appNotice.Delete("/section/:id", auth.RequirePermission("notice:write"), notice.HandlerDeleteSection(pgx))
+	appNotice.Post("/section/:id/subscriber", auth.RequirePermission("notice:write"), notice.HandlerAddSubscriber(pgx))
+	appNotice.Put("/section/:id/subscriber/:roomId", auth.RequirePermission("notice:write"), notice.HandlerUpdateSubscriber(pgx))
+	appNotice.Delete("/section/:id/subscriber/:roomId", auth.RequirePermission("notice:write"), notice.HandlerDeleteSubscriber(pgx))
+	appNotice.Get("/section/:id/template", auth.RequirePermission("notice:read"), notice.HandlerGetTemplate(pgx))
+	appNotice.Post("/section/:id/template", auth.RequirePermission("notice:write"), notice.HandlerAddTemplate(pgx))
+	appNotice.Put("/section/:id/template/:name", auth.RequirePermission("notice:write"), notice.HandlerUpdateTemplate(pgx))
+	appNotice.Delete("/section/:id/template/:name", auth.RequirePermission("notice:write"), notice.HandlerDeleteTemplate(pgx))
+	appNotice.Post("/section/:id/template/:name/preview", auth.RequirePermission("notice:read"), notice.HandlerPreviewTemplate(pgx))
+
+	appApi := app.Group("/api", auth.HandlerAuthMiddleware(pgx, storeSession))
+	appApi.Get("/url", auth.RequirePermission("shorturl:read"), shorturl.HandlerGetURL(pgx))
+	appApi.Post("/url", auth.RequirePermission("shorturl:write"), shorturl.HandlerAddURL(pgx))
 
 	app.Use(func(c *fiber.Ctx) error {
 		return c.Status(404).JSON(&api.HTTP{Error: "not implemented"})
@@ -122,6 +213,11 @@ func main() {
 		}
 	}
 
+	db.Debug(" - Stop Monitor Scheduler")
+	scheduler.Stop()
+	db.Debug(" - Stop Notice Worker")
+	worker.Stop()
+
 	if err := storeSession.Close(); err != nil {
 		db.Trace.Fatalf("session: %s", err)
 	}